@@ -9,10 +9,11 @@ import (
 )
 
 func init() {
-	server.Handle(`/api/logout/`, logoutAPI)
+	api := server.NewGroup(`/api`)
+	api.Handle(`/logout/`, logoutAPI)
 
 	//刷新模板缓存
-	server.Handle(`/api/refresh/`, refreshTmpl)
+	api.Handle(`/refresh/`, refreshTmpl)
 
 	//pprof debug api
 	server.Handle("/debug/pprof/cmdline", http.HandlerFunc(pprof.Cmdline))
@@ -0,0 +1,374 @@
+// `accesslog.go` 实现了访问日志中间件，支持 Apache Common、Combined 格式、JSON lines 以及自定义格式。
+// 自定义格式使用 Apache `mod_log_config` 的指令子集：
+//
+//	%h 客户端地址    %l 固定为 -     %u 用户名      %t 请求时间     %r 请求行
+//	%s 状态码       %>s 状态码      %b 响应大小（0 时为 -）          %B 响应大小
+//	%D 耗时（微秒）  %T 耗时（秒）    %m 请求方法     %U 请求路径     %q 查询字符串
+//	%H 协议         %L 请求 ID      %{Name}i 请求头 %{Name}o 响应头 %% 百分号
+//
+// 与 Apache 相同，请求行、请求及响应头等来自客户端的值中的 `"`、`\`、控制字符及非 ASCII 字节会被转义。
+// 请求 ID 由 `RequestID` 中间件生成，访问日志中间件在其外层时从响应头中读取。
+package server
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"gosurf/util"
+	"io"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	CommonLogFormat   = `%h %l %u %t "%r" %>s %b`
+	CombinedLogFormat = `%h %l %u %t "%r" %>s %b "%{Referer}i" "%{User-Agent}i"`
+	// JSON lines 格式，每行一个 JSON 对象
+	JSONLogFormat = "json"
+)
+
+type AccessLogConfig struct {
+	// 日志格式，默认为 `CommonLogFormat`
+	Format string
+	// 不记录日志的路径前缀，如 `/debug/pprof`
+	Exclude []string
+	// 是否使用单独的 goroutine 缓冲写入
+	Async bool
+	// 异步写入时等待写入的日志条数上限，队列已满时阻塞，默认 1024
+	BufferSize int
+}
+
+type AccessLog struct {
+	w       io.Writer
+	mu      sync.Mutex
+	format  []logField
+	json    bool
+	exclude []string
+
+	// async writing
+	lines  chan []byte
+	done   chan struct{}
+	state  sync.RWMutex
+	closed bool
+}
+
+type logEntry struct {
+	r       *http.Request
+	w       ResponseWriter
+	start   time.Time
+	latency time.Duration
+}
+
+type logField func(buf *bytes.Buffer, e *logEntry)
+
+// `NewAccessLog` 创建访问日志，异步写入时需在关闭服务器时调用 `Close`（如通过 `OnShutdown` 注册）。
+func NewAccessLog(w io.Writer, cfg AccessLogConfig) *AccessLog {
+	al := &AccessLog{w: w, exclude: cfg.Exclude}
+	switch cfg.Format {
+	case "":
+		al.format = parseLogFormat(CommonLogFormat)
+	case JSONLogFormat:
+		al.json = true
+	default:
+		al.format = parseLogFormat(cfg.Format)
+	}
+
+	if cfg.Async {
+		size := cfg.BufferSize
+		if size <= 0 {
+			size = 1024
+		}
+		al.lines = make(chan []byte, size)
+		al.done = make(chan struct{})
+		go al.flushLoop()
+	}
+	return al
+}
+
+// `Middleware` 为访问日志中间件，可通过 `Proxy.Use(al.Middleware)` 使用。
+func (al *AccessLog) Middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		for _, prefix := range al.exclude {
+			if strings.HasPrefix(r.URL.Path, prefix) {
+				next.ServeHTTP(w, r)
+				return
+			}
+		}
+
+		e := &logEntry{r: r, w: WrapResponseWriter(w), start: time.Now()}
+		defer al.log(e)
+		next.ServeHTTP(e.w, r)
+	})
+}
+
+func (al *AccessLog) log(e *logEntry) {
+	e.latency = time.Since(e.start)
+
+	var buf bytes.Buffer
+	if al.json {
+		al.writeJSON(&buf, e)
+	} else {
+		for _, f := range al.format {
+			f(&buf, e)
+		}
+		buf.WriteByte('\n')
+	}
+
+	if al.lines != nil {
+		al.state.RLock()
+		if !al.closed {
+			al.lines <- buf.Bytes()
+			al.state.RUnlock()
+			return
+		}
+		al.state.RUnlock()
+	}
+	al.mu.Lock()
+	defer al.mu.Unlock()
+	al.w.Write(buf.Bytes())
+}
+
+func (al *AccessLog) flushLoop() {
+	defer close(al.done)
+	bw := bufio.NewWriter(al.w)
+	for line := range al.lines {
+		bw.Write(line)
+		// 队列中没有等待写入的日志时刷新缓冲区
+		if len(al.lines) == 0 {
+			bw.Flush()
+		}
+	}
+	bw.Flush()
+}
+
+// `Close` 写入所有缓冲的日志，之后记录的日志将直接同步写入。
+func (al *AccessLog) Close() error {
+	if al.lines == nil {
+		return nil
+	}
+	al.state.Lock()
+	if !al.closed {
+		al.closed = true
+		close(al.lines)
+	}
+	al.state.Unlock()
+	<-al.done
+	return nil
+}
+
+func (e *logEntry) status() int {
+	if s := e.w.Status(); s != 0 {
+		return s
+	}
+	return http.StatusOK
+}
+
+func (e *logEntry) host() string {
+	host, _, err := net.SplitHostPort(e.r.RemoteAddr)
+	if err != nil {
+		return e.r.RemoteAddr
+	}
+	return host
+}
+
+func (e *logEntry) user() string {
+	if u, _, ok := e.r.BasicAuth(); ok && u != "" {
+		return u
+	}
+	return "-"
+}
+
+func (e *logEntry) requestID() string {
+	if id := util.RequestID(e.r.Context()); id != "" {
+		return id
+	}
+	return e.w.Header().Get(RequestIDHeader)
+}
+
+type jsonLogEntry struct {
+	Time      string  `json:"time"`
+	Remote    string  `json:"remote"`
+	User      string  `json:"user,omitempty"`
+	Method    string  `json:"method"`
+	Path      string  `json:"path"`
+	Query     string  `json:"query,omitempty"`
+	Proto     string  `json:"proto"`
+	Status    int     `json:"status"`
+	Bytes     int64   `json:"bytes"`
+	Latency   float64 `json:"latency_ms"`
+	Referer   string  `json:"referer,omitempty"`
+	UserAgent string  `json:"user_agent,omitempty"`
+	RequestID string  `json:"request_id,omitempty"`
+}
+
+func (al *AccessLog) writeJSON(buf *bytes.Buffer, e *logEntry) {
+	entry := jsonLogEntry{
+		Time:      e.start.Format(time.RFC3339Nano),
+		Remote:    e.host(),
+		Method:    e.r.Method,
+		Path:      e.r.URL.Path,
+		Query:     e.r.URL.RawQuery,
+		Proto:     e.r.Proto,
+		Status:    e.status(),
+		Bytes:     e.w.Size(),
+		Latency:   float64(e.latency) / float64(time.Millisecond),
+		Referer:   e.r.Referer(),
+		UserAgent: e.r.UserAgent(),
+		RequestID: e.requestID(),
+	}
+	if u := e.user(); u != "-" {
+		entry.User = u
+	}
+	json.NewEncoder(buf).Encode(entry)
+}
+
+// `parseLogFormat` 将格式字符串预先解析为字段列表，无法识别的指令按原样输出。
+func parseLogFormat(format string) []logField {
+	var (
+		fields  []logField
+		literal strings.Builder
+	)
+	flush := func() {
+		if literal.Len() > 0 {
+			s := literal.String()
+			fields = append(fields, func(buf *bytes.Buffer, _ *logEntry) { buf.WriteString(s) })
+			literal.Reset()
+		}
+	}
+
+	for i := 0; i < len(format); i++ {
+		if format[i] != '%' || i+1 == len(format) {
+			literal.WriteByte(format[i])
+			continue
+		}
+
+		start := i
+		i++
+		var arg string
+		if format[i] == '{' {
+			end := strings.IndexByte(format[i:], '}')
+			if end < 0 || i+end+1 >= len(format) {
+				literal.WriteString(format[start:])
+				break
+			}
+			arg = format[i+1 : i+end]
+			i += end + 1
+		}
+		if format[i] == '>' && i+1 < len(format) {
+			i++
+		}
+
+		f := logDirective(format[i], arg)
+		if f == nil {
+			literal.WriteString(format[start : i+1])
+			continue
+		}
+		flush()
+		fields = append(fields, f)
+	}
+	flush()
+	return fields
+}
+
+func logDirective(c byte, arg string) logField {
+	switch c {
+	case '%':
+		return func(buf *bytes.Buffer, _ *logEntry) { buf.WriteByte('%') }
+	case 'h':
+		return func(buf *bytes.Buffer, e *logEntry) { buf.WriteString(e.host()) }
+	case 'l':
+		return func(buf *bytes.Buffer, _ *logEntry) { buf.WriteByte('-') }
+	case 'u':
+		return func(buf *bytes.Buffer, e *logEntry) { writeEscaped(buf, e.user()) }
+	case 't':
+		return func(buf *bytes.Buffer, e *logEntry) {
+			buf.WriteString(e.start.Format("[02/Jan/2006:15:04:05 -0700]"))
+		}
+	case 'r':
+		return func(buf *bytes.Buffer, e *logEntry) {
+			writeEscaped(buf, e.r.Method+" "+e.r.URL.RequestURI()+" "+e.r.Proto)
+		}
+	case 's':
+		return func(buf *bytes.Buffer, e *logEntry) { buf.WriteString(strconv.Itoa(e.status())) }
+	case 'b':
+		return func(buf *bytes.Buffer, e *logEntry) {
+			if n := e.w.Size(); n > 0 {
+				buf.WriteString(strconv.FormatInt(n, 10))
+			} else {
+				buf.WriteByte('-')
+			}
+		}
+	case 'B':
+		return func(buf *bytes.Buffer, e *logEntry) { buf.WriteString(strconv.FormatInt(e.w.Size(), 10)) }
+	case 'D':
+		return func(buf *bytes.Buffer, e *logEntry) {
+			buf.WriteString(strconv.FormatInt(e.latency.Microseconds(), 10))
+		}
+	case 'T':
+		return func(buf *bytes.Buffer, e *logEntry) {
+			buf.WriteString(strconv.FormatInt(int64(e.latency/time.Second), 10))
+		}
+	case 'm':
+		return func(buf *bytes.Buffer, e *logEntry) { buf.WriteString(e.r.Method) }
+	case 'U':
+		return func(buf *bytes.Buffer, e *logEntry) { writeEscaped(buf, e.r.URL.Path) }
+	case 'q':
+		return func(buf *bytes.Buffer, e *logEntry) {
+			if e.r.URL.RawQuery != "" {
+				buf.WriteString("?" + e.r.URL.RawQuery)
+			}
+		}
+	case 'H':
+		return func(buf *bytes.Buffer, e *logEntry) { buf.WriteString(e.r.Proto) }
+	case 'L':
+		return func(buf *bytes.Buffer, e *logEntry) { writeOrDash(buf, e.requestID()) }
+	case 'i':
+		return func(buf *bytes.Buffer, e *logEntry) { writeOrDash(buf, e.r.Header.Get(arg)) }
+	case 'o':
+		return func(buf *bytes.Buffer, e *logEntry) { writeOrDash(buf, e.w.Header().Get(arg)) }
+	}
+	return nil
+}
+
+func writeOrDash(buf *bytes.Buffer, s string) {
+	if s == "" {
+		buf.WriteByte('-')
+		return
+	}
+	writeEscaped(buf, s)
+}
+
+// `writeEscaped` 按 Apache 的方式转义来自客户端的值，避免伪造日志行或字段：
+// `"`、`\` 前加 `\`，控制字符及非 ASCII 字节写为 `\n`、`\xhh` 等形式。
+func writeEscaped(buf *bytes.Buffer, s string) {
+	const hex = "0123456789abcdef"
+	for i := 0; i < len(s); i++ {
+		switch c := s[i]; {
+		case c == '"' || c == '\\':
+			buf.WriteByte('\\')
+			buf.WriteByte(c)
+		case c == '\b':
+			buf.WriteString(`\b`)
+		case c == '\n':
+			buf.WriteString(`\n`)
+		case c == '\r':
+			buf.WriteString(`\r`)
+		case c == '\t':
+			buf.WriteString(`\t`)
+		case c == '\v':
+			buf.WriteString(`\v`)
+		case c == '\f':
+			buf.WriteString(`\f`)
+		case c < 0x20 || c >= 0x7f:
+			buf.WriteString(`\x`)
+			buf.WriteByte(hex[c>>4])
+			buf.WriteByte(hex[c&0xf])
+		default:
+			buf.WriteByte(c)
+		}
+	}
+}
@@ -0,0 +1,99 @@
+package server
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"regexp"
+	"strings"
+	"testing"
+)
+
+func TestAccessLogCombined(t *testing.T) {
+	var buf bytes.Buffer
+	al := NewAccessLog(&buf, AccessLogConfig{Format: CombinedLogFormat, Exclude: []string{"/debug/pprof"}})
+
+	p := NewProxy(context.Background(), ":0", nil)
+	p.Use(al.Middleware)
+	p.Handle(`/a/`, nameHandler("hello"))
+	p.Handle(`/debug/pprof/.*`, nameHandler("pprof"))
+
+	r := httptest.NewRequest("GET", "/a/?x=1", nil)
+	r.Header.Set("Referer", "http://example.com/")
+	r.Header.Set("User-Agent", "test-agent")
+	r.SetBasicAuth("admin", "secret")
+	p.ServeHTTP(httptest.NewRecorder(), r)
+	serve(p, "GET", "/missing/")
+	serve(p, "GET", "/debug/pprof/heap")
+
+	lines := strings.Split(strings.TrimSpace(buf.String()), "\n")
+	if len(lines) != 2 {
+		t.Fatalf("expect 2 lines, got %q", buf.String())
+	}
+	re := regexp.MustCompile(`^192\.0\.2\.1 - admin \[[^\]]+\] "GET /a/\?x=1 HTTP/1\.1" 200 5 "http://example\.com/" "test-agent"$`)
+	if !re.MatchString(lines[0]) {
+		t.Errorf("unexpected line %q", lines[0])
+	}
+	if !strings.Contains(lines[1], `"GET /missing/ HTTP/1.1" 404 19`) {
+		t.Errorf("unexpected line %q", lines[1])
+	}
+}
+
+func TestAccessLogCustomFormat(t *testing.T) {
+	var buf bytes.Buffer
+	al := NewAccessLog(&buf, AccessLogConfig{Format: `%m %U%q %s %B %{X-Out}o %{X-Missing}i 100%%`})
+	h := al.Middleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("X-Out", "v")
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	h.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("DELETE", "/a?b=c", nil))
+
+	if line := buf.String(); line != "DELETE /a?b=c 204 0 v - 100%\n" {
+		t.Errorf("unexpected line %q", line)
+	}
+}
+
+func TestAccessLogEscape(t *testing.T) {
+	var buf bytes.Buffer
+	al := NewAccessLog(&buf, AccessLogConfig{Format: CombinedLogFormat})
+	h := al.Middleware(nameHandler("hello"))
+
+	r := httptest.NewRequest("GET", "/a%0a%22b", nil)
+	r.Header.Set("User-Agent", "evil\" \\ \n127.0.0.1 - - [x] \"GET / HTTP/1.1\" 200 5\x1b[2J\xff")
+	h.ServeHTTP(httptest.NewRecorder(), r)
+
+	line := buf.String()
+	if strings.Count(line, "\n") != 1 {
+		t.Fatalf("expect a single line, got %q", line)
+	}
+	if !strings.Contains(line, `"GET /a%0a%22b HTTP/1.1"`) {
+		t.Errorf("unexpected request line in %q", line)
+	}
+	if ua := `"evil\" \\ \n127.0.0.1 - - [x] \"GET / HTTP/1.1\" 200 5\x1b[2J\xff"`; !strings.HasSuffix(line, ua+"\n") {
+		t.Errorf("expect escaped User-Agent %s, got %q", ua, line)
+	}
+}
+
+func TestAccessLogJSONAsync(t *testing.T) {
+	var buf bytes.Buffer
+	al := NewAccessLog(&buf, AccessLogConfig{Format: JSONLogFormat, Async: true})
+	h := al.Middleware(nameHandler("hello"))
+	for i := 0; i < 3; i++ {
+		h.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", "/a?b=c", nil))
+	}
+	al.Close()
+
+	lines := strings.Split(strings.TrimSpace(buf.String()), "\n")
+	if len(lines) != 3 {
+		t.Fatalf("expect 3 lines, got %q", buf.String())
+	}
+	var entry jsonLogEntry
+	if err := json.Unmarshal([]byte(lines[0]), &entry); err != nil {
+		t.Fatal(err)
+	}
+	if entry.Method != "GET" || entry.Path != "/a" || entry.Query != "b=c" || entry.Status != 200 || entry.Bytes != 5 {
+		t.Errorf("unexpected entry %+v", entry)
+	}
+}
@@ -0,0 +1,288 @@
+// `compress.go` 实现了响应压缩中间件。
+// 根据请求的 `Accept-Encoding`（支持 q 值）选择编码，内置 gzip 及 deflate，
+// 其他编码（如 brotli）可通过 `RegisterEncoder` 注册。
+// 响应体在达到最小压缩大小前先缓存在内存中，不足该大小或 `Content-Type` 不在允许列表中的响应原样输出；
+// 已设置 `Content-Encoding`（如预压缩的静态文件）、部分内容（206）及无响应体的响应同样不压缩。
+// HEAD 请求与 GET 请求使用相同的协商结果，根据 `Content-Length`（未设置时视为足够大）判断是否达到最小压缩大小。
+// 调用 `Flush` 时立即开始输出，因此流式响应仍能及时送达客户端。
+package server
+
+import (
+	"compress/flate"
+	"compress/gzip"
+	"compress/zlib"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// `Encoder` 为压缩编码的写入器，`Reset` 用于复用写入器。
+type Encoder interface {
+	io.WriteCloser
+	Flush() error
+	Reset(w io.Writer)
+}
+
+type encoderEntry struct {
+	encoding   string
+	newEncoder func(w io.Writer, level int) Encoder
+}
+
+var (
+	encoderRW = new(sync.RWMutex)
+	encoders  = []encoderEntry{
+		{"gzip", func(w io.Writer, level int) Encoder {
+			enc, _ := gzip.NewWriterLevel(w, level)
+			return enc
+		}},
+		// HTTP 中的 deflate 为 zlib 格式（RFC 9110），而非原始的 DEFLATE 数据
+		{"deflate", func(w io.Writer, level int) Encoder {
+			enc, _ := zlib.NewWriterLevel(w, level)
+			return enc
+		}},
+	}
+)
+
+// `RegisterEncoder` 注册压缩编码，已存在的编码将被替换。
+// 客户端对多个编码的 q 值相同时，后注册的编码优先，如注册 brotli 后优先使用 `br`。
+// 编码需在创建使用它的中间件之前注册。
+//
+//	RegisterEncoder("br", func(w io.Writer, level int) Encoder { return brotli.NewWriterLevel(w, level) })
+func RegisterEncoder(encoding string, newEncoder func(w io.Writer, level int) Encoder) {
+	encoderRW.Lock()
+	defer encoderRW.Unlock()
+	for i, e := range encoders {
+		if strings.EqualFold(e.encoding, encoding) {
+			encoders = append(encoders[:i], encoders[i+1:]...)
+			break
+		}
+	}
+	encoders = append([]encoderEntry{{encoding, newEncoder}}, encoders...)
+}
+
+var defaultCompressTypes = []string{
+	"text/*",
+	"application/json",
+	"application/javascript",
+	"application/xml",
+	"application/wasm",
+	"image/svg+xml",
+}
+
+type CompressConfig struct {
+	// 压缩级别，对应 `compress/flate` 中的级别，默认为 `flate.DefaultCompression`
+	Level int
+	// 最小压缩大小（字节），默认 1024
+	MinSize int
+	// 允许压缩的 `Content-Type`，支持 `text/*` 形式的通配，默认包括文本、JSON、JavaScript、XML 及 SVG
+	Types []string
+}
+
+type compressor struct {
+	minSize int
+	types   []string
+	order   []string
+	pools   map[string]*sync.Pool
+}
+
+// `Compress` 返回响应压缩中间件，`cfg.Level` 不合法时 panic。
+func Compress(cfg CompressConfig) Middleware {
+	if cfg.Level == 0 {
+		cfg.Level = flate.DefaultCompression
+	}
+	if cfg.Level < flate.HuffmanOnly || cfg.Level > flate.BestCompression {
+		panic("server: invalid compression level")
+	}
+	c := &compressor{minSize: cfg.MinSize, types: cfg.Types, pools: make(map[string]*sync.Pool)}
+	if c.minSize <= 0 {
+		c.minSize = 1024
+	}
+	if c.types == nil {
+		c.types = defaultCompressTypes
+	}
+
+	encoderRW.RLock()
+	for _, e := range encoders {
+		newEncoder, level := e.newEncoder, cfg.Level
+		c.order = append(c.order, e.encoding)
+		c.pools[e.encoding] = &sync.Pool{New: func() interface{} { return newEncoder(io.Discard, level) }}
+	}
+	encoderRW.RUnlock()
+
+	return c.middleware
+}
+
+func (c *compressor) middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		addVary(w.Header(), "Accept-Encoding")
+		encoding := c.negotiate(r.Header.Get("Accept-Encoding"))
+		if encoding == "" {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		cw := &compressWriter{ResponseWriter: w, c: c, encoding: encoding, head: r.Method == http.MethodHead}
+		defer cw.close()
+		next.ServeHTTP(cw, r)
+	})
+}
+
+// `negotiate` 选择客户端可接受且 q 值最高的编码，q 值相同时按注册顺序选择。
+func (c *compressor) negotiate(accept string) string {
+	if accept == "" {
+		return ""
+	}
+	var (
+		best string
+		max  float64
+	)
+	for _, enc := range c.order {
+		if q := encodingQuality(accept, enc); q > max {
+			best, max = enc, q
+		}
+	}
+	return best
+}
+
+func (c *compressor) compressible(ctype string) bool {
+	ctype, _, _ = strings.Cut(ctype, ";")
+	ctype = strings.ToLower(strings.TrimSpace(ctype))
+	for _, t := range c.types {
+		if prefix, ok := strings.CutSuffix(t, "*"); (ok && strings.HasPrefix(ctype, prefix)) || ctype == t {
+			return true
+		}
+	}
+	return false
+}
+
+// `compressWriter` 缓存响应体直至能够判断是否压缩。
+type compressWriter struct {
+	http.ResponseWriter
+	c        *compressor
+	encoding string
+	head     bool
+	status   int
+	buf      []byte
+	decided  bool
+	enc      Encoder
+}
+
+func (cw *compressWriter) WriteHeader(code int) {
+	if code >= 100 && code < 200 {
+		cw.ResponseWriter.WriteHeader(code)
+		return
+	}
+	if cw.status == 0 && !cw.decided {
+		cw.status = code
+	}
+}
+
+func (cw *compressWriter) Write(b []byte) (int, error) {
+	if cw.status == 0 {
+		cw.status = http.StatusOK
+	}
+	if !cw.decided {
+		cw.buf = append(cw.buf, b...)
+		if len(cw.buf) < cw.c.minSize {
+			return len(b), nil
+		}
+		if err := cw.decide(true); err != nil {
+			return 0, err
+		}
+		return len(b), nil
+	}
+	if cw.enc != nil {
+		return cw.enc.Write(b)
+	}
+	return cw.ResponseWriter.Write(b)
+}
+
+// `decide` 判断是否压缩并写出响应头及已缓存的响应体，`sized` 表示响应体已达到最小压缩大小。
+func (cw *compressWriter) decide(sized bool) error {
+	cw.decided = true
+	if cw.status == 0 {
+		cw.status = http.StatusOK
+	}
+
+	h := cw.Header()
+	if h.Get("Content-Type") == "" && len(cw.buf) > 0 {
+		h.Set("Content-Type", http.DetectContentType(cw.buf))
+	}
+	if sized && h.Get("Content-Encoding") == "" && cw.status != http.StatusPartialContent &&
+		cw.status != http.StatusNoContent && cw.status != http.StatusNotModified &&
+		cw.c.compressible(h.Get("Content-Type")) {
+		h.Del("Content-Length")
+		h.Set("Content-Encoding", cw.encoding)
+		// 压缩后的内容与原内容不同，强 ETag 改为弱 ETag
+		if etag := h.Get("ETag"); strings.HasPrefix(etag, `"`) {
+			h.Set("ETag", "W/"+etag)
+		}
+		if !cw.head {
+			cw.enc = cw.c.pools[cw.encoding].Get().(Encoder)
+			cw.enc.Reset(cw.ResponseWriter)
+		}
+	}
+
+	cw.ResponseWriter.WriteHeader(cw.status)
+	buf := cw.buf
+	cw.buf = nil
+	if len(buf) == 0 {
+		return nil
+	}
+	var err error
+	if cw.enc != nil {
+		_, err = cw.enc.Write(buf)
+	} else {
+		_, err = cw.ResponseWriter.Write(buf)
+	}
+	return err
+}
+
+// `Flush` 立即输出已缓存的内容，流式响应不受最小压缩大小的限制。
+func (cw *compressWriter) Flush() {
+	if !cw.decided {
+		cw.decide(true)
+	}
+	if cw.enc != nil {
+		cw.enc.Flush()
+	}
+	http.NewResponseController(cw.ResponseWriter).Flush()
+}
+
+func (cw *compressWriter) close() {
+	if !cw.decided {
+		switch {
+		case cw.head:
+			cw.decide(cw.headSized())
+		case cw.status == 0 && len(cw.buf) == 0:
+			// 处理方法没有写出任何内容（如已被 Hijack），由 net/http 处理
+			return
+		default:
+			cw.decide(false)
+		}
+	}
+	if cw.enc != nil {
+		cw.enc.Close()
+		cw.enc.Reset(io.Discard)
+		cw.c.pools[cw.encoding].Put(cw.enc)
+		cw.enc = nil
+	}
+}
+
+// `headSized` 判断 HEAD 请求对应的 GET 响应是否达到最小压缩大小，
+// 处理方法写出了响应体时按其大小判断，否则按 `Content-Length` 判断。
+func (cw *compressWriter) headSized() bool {
+	if len(cw.buf) > 0 {
+		return false
+	}
+	cl := cw.Header().Get("Content-Length")
+	if cl == "" {
+		return true
+	}
+	n, err := strconv.Atoi(cl)
+	return err == nil && n >= cw.c.minSize
+}
+
+func (cw *compressWriter) Unwrap() http.ResponseWriter { return cw.ResponseWriter }
@@ -0,0 +1,188 @@
+package server
+
+import (
+	"bufio"
+	"compress/gzip"
+	"compress/zlib"
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestCompress(t *testing.T) {
+	large := strings.Repeat(`{"key":"value"}`, 200)
+
+	p := NewProxy(context.Background(), ":0", nil)
+	p.Use(Compress(CompressConfig{MinSize: 256}))
+	p.Handle(`/json/`, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		w.Header().Set("Content-Length", "3000")
+		w.Header().Set("ETag", `"abc"`)
+		io.WriteString(w, large[:1000])
+		io.WriteString(w, large[1000:])
+	}))
+	p.Handle(`/small/`, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		io.WriteString(w, `{}`)
+	}))
+	p.Handle(`/png/`, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "image/png")
+		io.WriteString(w, large)
+	}))
+	p.Handle(`/sniff/`, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusCreated)
+		io.WriteString(w, "<html>"+large)
+	}))
+	p.Handle(`/encoded/`, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/plain")
+		w.Header().Set("Content-Encoding", "br")
+		io.WriteString(w, large)
+	}))
+
+	get := func(target, accept string) *httptest.ResponseRecorder {
+		r := httptest.NewRequest("GET", target, nil)
+		r.Header.Set("Accept-Encoding", accept)
+		w := httptest.NewRecorder()
+		p.ServeHTTP(w, r)
+		return w
+	}
+
+	w := get("/json/", "deflate;q=0.5, gzip")
+	if enc := w.Header().Get("Content-Encoding"); enc != "gzip" {
+		t.Fatalf("expect gzip, got %q", enc)
+	}
+	if w.Header().Get("Content-Length") != "" || w.Header().Get("Vary") != "Accept-Encoding" || w.Header().Get("ETag") != `W/"abc"` {
+		t.Errorf("unexpected headers %v", w.Header())
+	}
+	zr, err := gzip.NewReader(w.Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if b, _ := io.ReadAll(zr); string(b) != large {
+		t.Errorf("unexpected body of length %d", len(b))
+	}
+
+	w = get("/json/", "gzip;q=0.1, deflate")
+	if enc := w.Header().Get("Content-Encoding"); enc != "deflate" {
+		t.Fatalf("expect deflate, got %q", enc)
+	}
+	zr2, err := zlib.NewReader(w.Body)
+	if err != nil {
+		t.Fatalf("deflate should use the zlib format: %v", err)
+	}
+	if b, _ := io.ReadAll(zr2); string(b) != large {
+		t.Errorf("unexpected body of length %d", len(b))
+	}
+
+	// HEAD 与 GET 的协商结果一致
+	for _, c := range []struct{ target, encoding string }{{"/json/", "gzip"}, {"/small/", ""}} {
+		r := httptest.NewRequest("HEAD", c.target, nil)
+		r.Header.Set("Accept-Encoding", "gzip")
+		w := httptest.NewRecorder()
+		p.ServeHTTP(w, r)
+		if w.Header().Get("Content-Encoding") != c.encoding || w.Header().Get("Vary") != "Accept-Encoding" {
+			t.Errorf("HEAD %s: unexpected headers %v", c.target, w.Header())
+		}
+	}
+
+	w = get("/sniff/", "gzip")
+	if w.Code != http.StatusCreated || w.Header().Get("Content-Encoding") != "gzip" || !strings.HasPrefix(w.Header().Get("Content-Type"), "text/html") {
+		t.Errorf("expect sniffed html to be compressed, got %d %v", w.Code, w.Header())
+	}
+
+	for _, c := range []struct{ target, accept, encoding string }{
+		{"/small/", "gzip", ""},
+		{"/png/", "gzip", ""},
+		{"/json/", "gzip;q=0, deflate;q=0", ""},
+		{"/json/", "", ""},
+		{"/json/", "identity", ""},
+		{"/encoded/", "gzip", "br"},
+	} {
+		w := get(c.target, c.accept)
+		if enc := w.Header().Get("Content-Encoding"); enc != c.encoding {
+			t.Errorf("%s %q: expect encoding %q, got %q", c.target, c.accept, c.encoding, enc)
+		}
+		if c.encoding == "" && w.Header().Get("Vary") != "Accept-Encoding" {
+			t.Errorf("%s %q: missing Vary", c.target, c.accept)
+		}
+	}
+	if w := get("/small/", "gzip"); w.Body.String() != "{}" {
+		t.Errorf("unexpected small body %q", w.Body.String())
+	}
+}
+
+type upperEncoder struct{ w io.Writer }
+
+func (e *upperEncoder) Write(b []byte) (int, error) {
+	return e.w.Write([]byte(strings.ToUpper(string(b))))
+}
+func (e *upperEncoder) Flush() error      { return nil }
+func (e *upperEncoder) Close() error      { return nil }
+func (e *upperEncoder) Reset(w io.Writer) { e.w = w }
+
+func TestRegisterEncoder(t *testing.T) {
+	RegisterEncoder("x-upper", func(w io.Writer, level int) Encoder { return &upperEncoder{w} })
+	defer func() {
+		encoderRW.Lock()
+		encoders = encoders[1:]
+		encoderRW.Unlock()
+	}()
+
+	h := Compress(CompressConfig{MinSize: 1})(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		io.WriteString(w, "hello")
+	}))
+	r := httptest.NewRequest("GET", "/", nil)
+	r.Header.Set("Accept-Encoding", "gzip, x-upper")
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, r)
+	if w.Header().Get("Content-Encoding") != "x-upper" || w.Body.String() != "HELLO" {
+		t.Errorf("expect later registered encoder to win ties, got %q %q", w.Header().Get("Content-Encoding"), w.Body.String())
+	}
+}
+
+func TestCompressFlush(t *testing.T) {
+	p := NewProxy(context.Background(), ":0", nil)
+	p.Use(Compress(CompressConfig{}))
+	release := make(chan struct{})
+	p.Handle(`/events/`, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/plain")
+		io.WriteString(w, "first\n")
+		w.(http.Flusher).Flush()
+		<-release
+		io.WriteString(w, "second\n")
+	}))
+	ts := httptest.NewServer(p)
+	defer ts.Close()
+
+	resp, err := http.Get(ts.URL + "/events/")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	if !resp.Uncompressed {
+		t.Error("expect transport to decompress gzip response")
+	}
+
+	line := make(chan string)
+	br := bufio.NewReader(resp.Body)
+	go func() {
+		s, _ := br.ReadString('\n')
+		line <- s
+	}()
+	select {
+	case s := <-line:
+		if s != "first\n" {
+			t.Errorf("unexpected line %q", s)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("flushed data did not arrive")
+	}
+	close(release)
+	if s, _ := br.ReadString('\n'); s != "second\n" {
+		t.Errorf("unexpected line %q", s)
+	}
+}
@@ -0,0 +1,130 @@
+// `converter.go` 实现了路由中的类型化参数。
+// 路由中形如 `{id:int}` 的片段会被展开为命名分组 `(?P<id>[0-9]+)`，
+// 省略转换器名称时（如 `{name}`）使用 `str` 转换器。
+// 转换器可以额外提供校验方法，校验失败时视为路由未匹配，最终未匹配任何路由时返回 404。
+package server
+
+import (
+	"encoding/hex"
+	"errors"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+type converter struct {
+	regex string
+	check func(s string) bool
+}
+
+var (
+	convRW     = new(sync.RWMutex)
+	converters = map[string]*converter{
+		"str":  {regex: `[^/]+`},
+		"int":  {regex: `[0-9]+`, check: isInt64},
+		"slug": {regex: `[-a-zA-Z0-9_]+`},
+		"uuid": {regex: `[0-9a-fA-F]{8}-[0-9a-fA-F]{4}-[0-9a-fA-F]{4}-[0-9a-fA-F]{4}-[0-9a-fA-F]{12}`},
+		"path": {regex: `.+`},
+	}
+)
+
+// `RegisterConverter` 注册自定义转换器，`regex` 中不能包含捕获分组，
+// `check` 可以为 `nil`，否则在正则匹配后对参数值做进一步校验。
+// 转换器需在使用它的路由注册之前注册。
+func RegisterConverter(name, regex string, check func(s string) bool) {
+	if !reIdent.MatchString(name) {
+		panic("server: invalid converter name " + name)
+	}
+	re := regexp.MustCompile(regex)
+	if re.NumSubexp() > 0 {
+		panic("server: converter " + name + " should not contain capture groups")
+	}
+	convRW.Lock()
+	defer convRW.Unlock()
+	converters[name] = &converter{regex: regex, check: check}
+}
+
+func isInt64(s string) bool {
+	_, err := strconv.ParseInt(s, 10, 64)
+	return err == nil
+}
+
+var (
+	reIdent = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*$`)
+	reParam = regexp.MustCompile(`^([A-Za-z_][A-Za-z0-9_]*)(?::([A-Za-z_][A-Za-z0-9_]*))?$`)
+)
+
+// `expand` 将路由中的 `{name:converter}` 展开为命名分组，并返回各参数对应的校验方法。
+// 不符合参数格式的花括号（如重复次数 `\d{2,4}`）保持原样。
+func expand(pattern string) (string, map[string]func(s string) bool) {
+	if !strings.Contains(pattern, "{") {
+		return pattern, nil
+	}
+
+	convRW.RLock()
+	defer convRW.RUnlock()
+
+	var (
+		buf    strings.Builder
+		checks map[string]func(s string) bool
+	)
+	for i := 0; i < len(pattern); i++ {
+		c := pattern[i]
+		if c == '\\' && i+1 < len(pattern) {
+			buf.WriteString(pattern[i : i+2])
+			i++
+			continue
+		}
+
+		j := strings.IndexByte(pattern[i:], '}')
+		if c != '{' || j < 0 {
+			buf.WriteByte(c)
+			continue
+		}
+
+		m := reParam.FindStringSubmatch(pattern[i+1 : i+j])
+		if m == nil {
+			buf.WriteByte(c)
+			continue
+		}
+
+		name, conv := m[1], m[2]
+		if conv == "" {
+			conv = "str"
+		}
+		cv, ok := converters[conv]
+		if !ok {
+			panic("server: unknown converter " + conv + " in pattern " + pattern)
+		}
+		buf.WriteString(`(?P<` + name + `>` + cv.regex + `)`)
+		if cv.check != nil {
+			if checks == nil {
+				checks = make(map[string]func(s string) bool)
+			}
+			checks[name] = cv.check
+		}
+		i += j
+	}
+	return buf.String(), checks
+}
+
+type UUID [16]byte
+
+// `ParseUUID` 解析 `xxxxxxxx-xxxx-xxxx-xxxx-xxxxxxxxxxxx` 格式的 UUID。
+func ParseUUID(s string) (u UUID, err error) {
+	if len(s) != 36 || s[8] != '-' || s[13] != '-' || s[18] != '-' || s[23] != '-' {
+		return u, errors.New("server: invalid uuid " + s)
+	}
+	b, err := hex.DecodeString(s[:8] + s[9:13] + s[14:18] + s[19:23] + s[24:])
+	if err != nil {
+		return u, errors.New("server: invalid uuid " + s)
+	}
+	copy(u[:], b)
+	return u, nil
+}
+
+func (u UUID) String() string {
+	s := hex.EncodeToString(u[:])
+	return s[:8] + "-" + s[8:12] + "-" + s[12:16] + "-" + s[16:20] + "-" + s[20:]
+}
@@ -0,0 +1,91 @@
+package server
+
+import (
+	"context"
+	"net/http"
+	"strconv"
+	"testing"
+)
+
+func TestExpand(t *testing.T) {
+	cases := map[string]string{
+		`/user/{id:int}/`:   `/user/(?P<id>[0-9]+)/`,
+		`/post/{slug:slug}`: `/post/(?P<slug>[-a-zA-Z0-9_]+)`,
+		`/tag/{name}/`:      `/tag/(?P<name>[^/]+)/`,
+		`/year/\d{4}/`:      `/year/\d{4}/`,
+		`/literal/\{id\}/`:  `/literal/\{id\}/`,
+	}
+	for pattern, expect := range cases {
+		if s, _ := expand(pattern); s != expect {
+			t.Errorf("%s: expect %s, got %s", pattern, expect, s)
+		}
+	}
+}
+
+func TestConverter(t *testing.T) {
+	p := NewProxy(context.Background(), ":0", nil)
+	p.Handle(`/user/{id:int}/`, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		id, err := r.Context().Value(CtxParamKey).(*Params).Int64("id")
+		if err != nil {
+			t.Error(err)
+		}
+		w.Write([]byte(strconv.FormatInt(id, 10)))
+	}))
+	p.Handle(`/item/{uuid:uuid}/`, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		u, err := r.Context().Value(CtxParamKey).(*Params).UUID("uuid")
+		if err != nil {
+			t.Error(err)
+		}
+		w.Write([]byte(u.String()))
+	}))
+
+	if body := serve(p, "GET", "/user/42/").Body.String(); body != "42" {
+		t.Errorf("expect 42, got %q", body)
+	}
+	if code := serve(p, "GET", "/user/abc/").Code; code != http.StatusNotFound {
+		t.Errorf("expect 404, got %d", code)
+	}
+	// 超出 int64 范围时由校验方法拒绝
+	if code := serve(p, "GET", "/user/99999999999999999999/").Code; code != http.StatusNotFound {
+		t.Errorf("expect 404, got %d", code)
+	}
+
+	u := "0f8fad5b-d9cb-469f-a165-70867728950e"
+	if body := serve(p, "GET", "/item/"+u+"/").Body.String(); body != u {
+		t.Errorf("expect %s, got %q", u, body)
+	}
+}
+
+func TestRegisterConverter(t *testing.T) {
+	RegisterConverter("even", `[0-9]+`, func(s string) bool {
+		i, err := strconv.Atoi(s)
+		return err == nil && i%2 == 0
+	})
+	p := NewProxy(context.Background(), ":0", nil)
+	p.Handle(`/n/{n:even}/`, View{Name: "even", Get: nameHandler("even").ServeHTTP})
+	p.Handle(`/n/{n:int}/`, nameHandler("int"))
+
+	if body := serve(p, "GET", "/n/4/").Body.String(); body != "even" {
+		t.Errorf("expect even, got %q", body)
+	}
+	// 校验失败时继续匹配后续路由
+	if body := serve(p, "GET", "/n/3/").Body.String(); body != "int" {
+		t.Errorf("expect int, got %q", body)
+	}
+	if url, err := p.Reverse("even", "n", "8"); err != nil || url != "/n/8/" {
+		t.Errorf("expect /n/8/, got %q (%v)", url, err)
+	}
+}
+
+func TestParamsError(t *testing.T) {
+	pm := &Params{m: map[string]string{"id": "abc"}}
+	if _, err := pm.Int("id"); err == nil {
+		t.Error("expect error for non-int param")
+	}
+	if _, err := pm.Int("missing"); err == nil {
+		t.Error("expect error for missing param")
+	}
+	if _, err := pm.UUID("id"); err == nil {
+		t.Error("expect error for invalid uuid")
+	}
+}
@@ -0,0 +1,163 @@
+// `cors.go` 实现了跨域资源共享（CORS）中间件。
+// 预检请求（带有 `Access-Control-Request-Method` 的 OPTIONS 请求）由中间件直接响应 204，不会到达路由的处理方法，
+// 因此 `View` 无需为跨域请求实现 `Options`；来源、方法或请求头不被允许时同样返回 204，但不带 CORS 响应头。
+// 中间件可以通过 `Use` 全局使用，也可以只用于路由组，如 `NewGroup("/api", CORS(cfg))`。
+package server
+
+import (
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+type CORSConfig struct {
+	// 允许的来源，支持精确匹配（如 `https://example.com`）、子域名通配（如 `https://*.example.com`）及 `*`
+	AllowOrigins []string
+	// 自定义的来源判断方法，与 `AllowOrigins` 满足其一即可
+	AllowOriginFunc func(origin string) bool
+	// 允许的请求方法，默认为 GET、HEAD、POST
+	AllowMethods []string
+	// 允许的请求头，为空时允许预检请求中列出的所有请求头
+	AllowHeaders []string
+	// 允许客户端读取的响应头
+	ExposeHeaders []string
+	// 是否允许携带 Cookie 等凭据，不能与 `*` 同时使用
+	AllowCredentials bool
+	// 预检结果的缓存时间，0 表示不设置
+	MaxAge time.Duration
+}
+
+type cors struct {
+	cfg       CORSConfig
+	any       bool
+	origins   map[string]bool
+	wildcards [][2]string
+	methods   string
+	headers   map[string]bool
+}
+
+// `CORS` 返回跨域资源共享中间件，`AllowOrigins` 包含 `*` 且 `AllowCredentials` 为 `true` 时 panic，
+// 否则任意网站均可携带用户凭据读取响应。
+func CORS(cfg CORSConfig) Middleware {
+	if len(cfg.AllowMethods) == 0 {
+		cfg.AllowMethods = []string{http.MethodGet, http.MethodHead, http.MethodPost}
+	}
+
+	c := &cors{cfg: cfg, origins: make(map[string]bool), methods: strings.Join(cfg.AllowMethods, ", ")}
+	for _, o := range cfg.AllowOrigins {
+		o = strings.ToLower(o)
+		if o == "*" {
+			if cfg.AllowCredentials {
+				panic("server: cors can not allow credentials for any origin")
+			}
+			c.any = true
+		} else if prefix, suffix, ok := strings.Cut(o, "*"); ok {
+			c.wildcards = append(c.wildcards, [2]string{prefix, suffix})
+		} else {
+			c.origins[o] = true
+		}
+	}
+	if len(cfg.AllowHeaders) > 0 {
+		c.headers = make(map[string]bool, len(cfg.AllowHeaders))
+		for _, h := range cfg.AllowHeaders {
+			c.headers[http.CanonicalHeaderKey(h)] = true
+		}
+	}
+	return c.middleware
+}
+
+func (c *cors) middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		origin := r.Header.Get("Origin")
+		preflight := r.Method == http.MethodOptions && r.Header.Get("Access-Control-Request-Method") != ""
+		h := w.Header()
+
+		if preflight {
+			addVary(h, "Origin")
+			addVary(h, "Access-Control-Request-Method")
+			addVary(h, "Access-Control-Request-Headers")
+			if origin != "" && c.allowOrigin(origin) && c.allowPreflight(r) {
+				c.setOrigin(h, origin)
+				h.Set("Access-Control-Allow-Methods", c.methods)
+				if reqHeaders := r.Header.Get("Access-Control-Request-Headers"); reqHeaders != "" {
+					if c.headers != nil {
+						h.Set("Access-Control-Allow-Headers", strings.Join(c.cfg.AllowHeaders, ", "))
+					} else {
+						h.Set("Access-Control-Allow-Headers", reqHeaders)
+					}
+				}
+				if c.cfg.MaxAge > 0 {
+					h.Set("Access-Control-Max-Age", strconv.Itoa(int(c.cfg.MaxAge/time.Second)))
+				}
+			}
+			w.WriteHeader(http.StatusNoContent)
+			return
+		}
+
+		if !c.any {
+			addVary(h, "Origin")
+		}
+		if origin != "" && c.allowOrigin(origin) {
+			c.setOrigin(h, origin)
+			if len(c.cfg.ExposeHeaders) > 0 {
+				h.Set("Access-Control-Expose-Headers", strings.Join(c.cfg.ExposeHeaders, ", "))
+			}
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+func (c *cors) setOrigin(h http.Header, origin string) {
+	if c.any {
+		h.Set("Access-Control-Allow-Origin", "*")
+		return
+	}
+	h.Set("Access-Control-Allow-Origin", origin)
+	if c.cfg.AllowCredentials {
+		h.Set("Access-Control-Allow-Credentials", "true")
+	}
+}
+
+func (c *cors) allowOrigin(origin string) bool {
+	if c.any {
+		return true
+	}
+	o := strings.ToLower(origin)
+	if c.origins[o] {
+		return true
+	}
+	for _, wc := range c.wildcards {
+		prefix, suffix := wc[0], wc[1]
+		if len(o) > len(prefix)+len(suffix) && strings.HasPrefix(o, prefix) && strings.HasSuffix(o, suffix) &&
+			!strings.ContainsAny(o[len(prefix):len(o)-len(suffix)], "/:@") {
+			return true
+		}
+	}
+	return c.cfg.AllowOriginFunc != nil && c.cfg.AllowOriginFunc(origin)
+}
+
+// `allowPreflight` 检查预检请求的方法及请求头是否被允许。
+func (c *cors) allowPreflight(r *http.Request) bool {
+	method := r.Header.Get("Access-Control-Request-Method")
+	allowed := false
+	for _, m := range c.cfg.AllowMethods {
+		if m == method {
+			allowed = true
+			break
+		}
+	}
+	if !allowed {
+		return false
+	}
+
+	if c.headers == nil {
+		return true
+	}
+	for _, reqHeader := range strings.Split(r.Header.Get("Access-Control-Request-Headers"), ",") {
+		if reqHeader = strings.TrimSpace(reqHeader); reqHeader != "" && !c.headers[http.CanonicalHeaderKey(reqHeader)] {
+			return false
+		}
+	}
+	return true
+}
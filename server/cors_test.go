@@ -0,0 +1,124 @@
+package server
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestCORS(t *testing.T) {
+	p := NewProxy(context.Background(), ":0", nil)
+	api := p.Group(`/api`, CORS(CORSConfig{
+		AllowOrigins:     []string{"https://app.example.com", "https://*.example.org"},
+		AllowOriginFunc:  func(origin string) bool { return origin == "http://localhost:3000" },
+		AllowMethods:     []string{"GET", "POST", "DELETE"},
+		AllowHeaders:     []string{"Content-Type", "X-Token"},
+		ExposeHeaders:    []string{"X-Request-ID"},
+		AllowCredentials: true,
+		MaxAge:           10 * time.Minute,
+	}))
+	api.Handle(`/user/`, View{Get: nameHandler("user").ServeHTTP, Delete: nameHandler("deleted").ServeHTTP})
+
+	do := func(method, origin string, header ...string) *httptest.ResponseRecorder {
+		r := httptest.NewRequest(method, "/api/user/", nil)
+		if origin != "" {
+			r.Header.Set("Origin", origin)
+		}
+		for i := 0; i < len(header); i += 2 {
+			r.Header.Set(header[i], header[i+1])
+		}
+		w := httptest.NewRecorder()
+		p.ServeHTTP(w, r)
+		return w
+	}
+
+	w := do("OPTIONS", "https://app.example.com", "Access-Control-Request-Method", "DELETE", "Access-Control-Request-Headers", "x-token, content-type")
+	if w.Code != http.StatusNoContent || w.Body.Len() != 0 {
+		t.Errorf("expect 204 preflight, got %d %q", w.Code, w.Body.String())
+	}
+	for k, v := range map[string]string{
+		"Access-Control-Allow-Origin":      "https://app.example.com",
+		"Access-Control-Allow-Credentials": "true",
+		"Access-Control-Allow-Methods":     "GET, POST, DELETE",
+		"Access-Control-Allow-Headers":     "Content-Type, X-Token",
+		"Access-Control-Max-Age":           "600",
+		"Allow":                            "",
+	} {
+		if got := w.Header().Get(k); got != v {
+			t.Errorf("preflight %s: expect %q, got %q", k, v, got)
+		}
+	}
+	if vary := w.Header().Values("Vary"); len(vary) != 3 || vary[0] != "Origin" {
+		t.Errorf("unexpected Vary %q", vary)
+	}
+
+	for _, c := range []struct {
+		origin, method, headers string
+	}{
+		{"https://evil.com", "GET", ""},
+		{"https://app.example.com", "PUT", ""},
+		{"https://app.example.com", "GET", "X-Other"},
+		{"https://example.org", "GET", ""},
+		{"https://a.example.org.evil.com", "GET", ""},
+		{"https://user@a.example.org", "GET", ""},
+	} {
+		w := do("OPTIONS", c.origin, "Access-Control-Request-Method", c.method, "Access-Control-Request-Headers", c.headers)
+		if w.Code != http.StatusNoContent || w.Header().Get("Access-Control-Allow-Origin") != "" {
+			t.Errorf("%+v: expect rejected preflight, got %d %v", c, w.Code, w.Header())
+		}
+	}
+
+	for _, origin := range []string{"https://a.b.example.org", "HTTPS://Shop.Example.org", "http://localhost:3000"} {
+		w := do("GET", origin)
+		if w.Body.String() != "user" || w.Header().Get("Access-Control-Allow-Origin") != origin {
+			t.Errorf("%s: unexpected response %q %v", origin, w.Body.String(), w.Header())
+		}
+		if w.Header().Get("Access-Control-Expose-Headers") != "X-Request-ID" {
+			t.Errorf("%s: missing exposed headers", origin)
+		}
+	}
+
+	// 非预检的 OPTIONS 请求及没有 Origin 的请求照常处理
+	if w := do("OPTIONS", ""); w.Header().Get("Allow") == "" {
+		t.Error("plain OPTIONS should reach the View")
+	}
+	if w := do("DELETE", ""); w.Body.String() != "deleted" || w.Header().Get("Access-Control-Allow-Origin") != "" || w.Header().Get("Vary") != "Origin" {
+		t.Errorf("unexpected response without origin %q %v", w.Body.String(), w.Header())
+	}
+}
+
+func TestCORSAnyOrigin(t *testing.T) {
+	h := CORS(CORSConfig{AllowOrigins: []string{"*"}})(nameHandler("ok"))
+
+	r := httptest.NewRequest("OPTIONS", "/", nil)
+	r.Header.Set("Origin", "https://anywhere.com")
+	r.Header.Set("Access-Control-Request-Method", "POST")
+	r.Header.Set("Access-Control-Request-Headers", "X-Custom")
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, r)
+	if w.Header().Get("Access-Control-Allow-Origin") != "*" || w.Header().Get("Access-Control-Allow-Headers") != "X-Custom" {
+		t.Errorf("unexpected preflight headers %v", w.Header())
+	}
+	if w.Header().Get("Access-Control-Allow-Credentials") != "" || w.Header().Get("Access-Control-Max-Age") != "" {
+		t.Errorf("unexpected preflight headers %v", w.Header())
+	}
+
+	r = httptest.NewRequest("GET", "/", nil)
+	r.Header.Set("Origin", "https://anywhere.com")
+	w = httptest.NewRecorder()
+	h.ServeHTTP(w, r)
+	if w.Header().Get("Access-Control-Allow-Origin") != "*" || w.Header().Get("Vary") != "" {
+		t.Errorf("unexpected headers %v", w.Header())
+	}
+}
+
+func TestCORSAnyOriginWithCredentials(t *testing.T) {
+	defer func() {
+		if recover() == nil {
+			t.Error("expect panic for any origin with credentials")
+		}
+	}()
+	CORS(CORSConfig{AllowOrigins: []string{"https://app.example.com", "*"}, AllowCredentials: true})
+}
@@ -0,0 +1,294 @@
+// `csrf.go` 实现了跨站请求伪造（CSRF）防护中间件，采用带签名的双重提交 Cookie：
+// 中间件为每个客户端下发包含随机值及其 HMAC 签名的 Cookie，表单通过 `csrf_field`（或请求头 `X-CSRF-Token`）
+// 提交由该随机值生成的令牌，不安全的请求方法（GET、HEAD、OPTIONS、TRACE 以外）须提交与 Cookie 一致的令牌。
+// 令牌每次生成时使用不同的掩码，避免页面压缩后遭受 BREACH 攻击。
+// HTTPS 请求还会检查 `Origin`（缺失时检查 `Referer`）是否与请求的域名或受信任的来源一致，
+// 由反向代理终止 TLS 时 `r.TLS` 为空，需设置 `Secure` 开启该检查及 Cookie 的 `Secure` 标志。
+// 校验失败时调用所属 `Proxy` 的 `func403`。
+//
+// 令牌绑定于 Cookie 而非登录会话，用户登录或退出时应删除该 Cookie（`MaxAge` 为 -1），使下一次请求重新下发。
+// 令牌仅由中间件校验，`form.Clean` 不做检查，表单须通过 `csrf_field` 提交令牌。
+package server
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"errors"
+	"html/template"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// 令牌随机值的长度（字节）
+const csrfTokenLen = 32
+
+type CSRFConfig struct {
+	// 签名 Cookie 使用的密钥，为空时随机生成，此时重启程序后已下发的 Cookie 失效
+	Key []byte
+	// Cookie 名称，默认为 `csrf_token`
+	CookieName string
+	// Cookie 路径，默认为 `/`
+	CookiePath string
+	// Cookie 域名，默认为空，即仅限当前域名
+	CookieDomain string
+	// Cookie 有效期，默认为 12 小时
+	MaxAge time.Duration
+	// 提交令牌的请求头，默认为 `X-CSRF-Token`
+	HeaderName string
+	// 提交令牌的表单字段，默认为 `csrf_token`
+	FieldName string
+	// 为 `true` 时视所有请求为 HTTPS：Cookie 带 `Secure` 标志并检查来源，用于反向代理终止 TLS 的部署，
+	// 为 `false` 时仅对 `r.TLS` 不为空的请求如此处理
+	Secure bool
+	// 受信任的来源（如 `https://admin.example.com`），用于 HTTPS 请求的 `Origin`、`Referer` 检查
+	TrustedOrigins []string
+	// 不检查令牌的路由名称，如供其他服务调用的 JSON API
+	ExemptRoutes []string
+	// 不检查令牌的路由组，组内（包括嵌套组内）的路由均不检查
+	ExemptGroups []*Group
+	// 自定义的豁免方法，返回 `true` 时不检查令牌
+	Exempt func(r *http.Request) bool
+}
+
+type csrf struct {
+	proxy   *Proxy
+	cfg     CSRFConfig
+	origins map[string]bool
+	routes  map[string]bool
+	groups  map[*Group]bool
+}
+
+type csrfKey struct{}
+
+// `csrfContext` 为请求 context 中保存的令牌随机值及表单字段名。
+type csrfContext struct {
+	secret []byte
+	field  string
+}
+
+// `CSRF` 返回跨站请求伪造防护中间件，通常通过 `Use` 全局使用，
+// 也可以只用于需要防护的路由组。
+func (p *Proxy) CSRF(cfg CSRFConfig) Middleware {
+	if len(cfg.Key) == 0 {
+		cfg.Key = make([]byte, 32)
+		rand.Read(cfg.Key)
+	}
+	if cfg.CookieName == "" {
+		cfg.CookieName = "csrf_token"
+	}
+	if cfg.CookiePath == "" {
+		cfg.CookiePath = "/"
+	}
+	if cfg.MaxAge == 0 {
+		cfg.MaxAge = 12 * time.Hour
+	}
+	if cfg.HeaderName == "" {
+		cfg.HeaderName = "X-CSRF-Token"
+	}
+	if cfg.FieldName == "" {
+		cfg.FieldName = "csrf_token"
+	}
+
+	c := &csrf{
+		proxy:   p,
+		cfg:     cfg,
+		origins: make(map[string]bool, len(cfg.TrustedOrigins)),
+		routes:  make(map[string]bool, len(cfg.ExemptRoutes)),
+		groups:  make(map[*Group]bool, len(cfg.ExemptGroups)),
+	}
+	for _, o := range cfg.TrustedOrigins {
+		c.origins[strings.ToLower(strings.TrimSuffix(o, "/"))] = true
+	}
+	for _, name := range cfg.ExemptRoutes {
+		c.routes[name] = true
+	}
+	for _, g := range cfg.ExemptGroups {
+		c.groups[g] = true
+	}
+	return c.middleware
+}
+
+func (c *csrf) middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		secret := c.secret(r)
+		if secret == nil {
+			secret = make([]byte, csrfTokenLen)
+			rand.Read(secret)
+			http.SetCookie(w, &http.Cookie{
+				Name:     c.cfg.CookieName,
+				Value:    c.sign(secret),
+				Path:     c.cfg.CookiePath,
+				Domain:   c.cfg.CookieDomain,
+				MaxAge:   int(c.cfg.MaxAge / time.Second),
+				Secure:   c.secure(r),
+				HttpOnly: true,
+				SameSite: http.SameSiteLaxMode,
+			})
+		}
+		r = r.WithContext(context.WithValue(r.Context(), csrfKey{}, &csrfContext{secret, c.cfg.FieldName}))
+
+		switch r.Method {
+		case http.MethodGet, http.MethodHead, http.MethodOptions, http.MethodTrace:
+			next.ServeHTTP(w, r)
+			return
+		}
+		if c.exempt(r) {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		if err := c.check(r, secret); err != nil {
+			c.proxy.serve403(w, r)
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// `check` 校验来源及提交的令牌。
+func (c *csrf) check(r *http.Request, secret []byte) error {
+	if c.secure(r) {
+		if err := c.checkOrigin(r); err != nil {
+			return err
+		}
+	}
+
+	token := r.Header.Get(c.cfg.HeaderName)
+	if token == "" {
+		token = r.PostFormValue(c.cfg.FieldName)
+	}
+	if token == "" {
+		return errors.New("server: csrf token missing")
+	}
+	if !unmaskToken(token, secret) {
+		return errors.New("server: csrf token invalid")
+	}
+	return nil
+}
+
+// `checkOrigin` 检查 HTTPS 请求的来源，`Origin` 缺失时使用 `Referer`，二者均缺失时拒绝请求。
+func (c *csrf) checkOrigin(r *http.Request) error {
+	origin := r.Header.Get("Origin")
+	if origin == "" {
+		referer, err := url.Parse(r.Referer())
+		if err != nil || referer.Host == "" {
+			return errors.New("server: csrf referer missing")
+		}
+		origin = referer.Scheme + "://" + referer.Host
+	}
+	origin = strings.ToLower(origin)
+	if origin == "https://"+strings.ToLower(r.Host) || c.origins[origin] {
+		return nil
+	}
+	return errors.New("server: csrf origin " + origin + " not allowed")
+}
+
+// `secure` 判断请求是否按 HTTPS 处理。
+func (c *csrf) secure(r *http.Request) bool {
+	return c.cfg.Secure || r.TLS != nil
+}
+
+// `exempt` 判断请求是否豁免令牌检查。
+func (c *csrf) exempt(r *http.Request) bool {
+	if c.cfg.Exempt != nil && c.cfg.Exempt(r) {
+		return true
+	}
+	if len(c.routes) == 0 && len(c.groups) == 0 {
+		return false
+	}
+
+	c.proxy.rw.RLock()
+	rt, _ := c.proxy.router.match(r)
+	c.proxy.rw.RUnlock()
+	if rt == nil {
+		return false
+	}
+	if rt.name != "" && c.routes[rt.name] {
+		return true
+	}
+	for g := rt.group; g != nil; g = g.parent {
+		if c.groups[g] {
+			return true
+		}
+	}
+	return false
+}
+
+// `secret` 返回 Cookie 中签名有效的随机值，Cookie 不存在或签名无效时返回 `nil`。
+func (c *csrf) secret(r *http.Request) []byte {
+	cookie, err := r.Cookie(c.cfg.CookieName)
+	if err != nil {
+		return nil
+	}
+	value, sig, ok := strings.Cut(cookie.Value, ".")
+	if !ok {
+		return nil
+	}
+	secret, err := base64.RawURLEncoding.DecodeString(value)
+	if err != nil || len(secret) != csrfTokenLen {
+		return nil
+	}
+	if !hmac.Equal([]byte(sig), []byte(c.mac(secret))) {
+		return nil
+	}
+	return secret
+}
+
+func (c *csrf) sign(secret []byte) string {
+	return base64.RawURLEncoding.EncodeToString(secret) + "." + c.mac(secret)
+}
+
+func (c *csrf) mac(secret []byte) string {
+	m := hmac.New(sha256.New, c.cfg.Key)
+	m.Write(secret)
+	return base64.RawURLEncoding.EncodeToString(m.Sum(nil))
+}
+
+// `maskToken` 使用随机掩码与随机值异或生成令牌，令牌由掩码及异或结果组成。
+func maskToken(secret []byte) string {
+	b := make([]byte, 2*len(secret))
+	mask, masked := b[:len(secret)], b[len(secret):]
+	rand.Read(mask)
+	for i := range secret {
+		masked[i] = secret[i] ^ mask[i]
+	}
+	return base64.RawURLEncoding.EncodeToString(b)
+}
+
+func unmaskToken(token string, secret []byte) bool {
+	b, err := base64.RawURLEncoding.DecodeString(token)
+	if err != nil || len(b) != 2*len(secret) {
+		return false
+	}
+	mask, masked := b[:len(secret)], b[len(secret):]
+	for i := range masked {
+		masked[i] ^= mask[i]
+	}
+	return subtle.ConstantTimeCompare(masked, secret) == 1
+}
+
+// `CSRFToken` 返回当前请求的 CSRF 令牌，用于 AJAX 请求的 `X-CSRF-Token` 头，
+// 模板中为 `{{ csrf_token .request }}`，请求未经过 CSRF 中间件时返回错误。
+func CSRFToken(r *http.Request) (string, error) {
+	cc, ok := r.Context().Value(csrfKey{}).(*csrfContext)
+	if !ok {
+		return "", errors.New("server: csrf middleware not in use")
+	}
+	return maskToken(cc.secret), nil
+}
+
+// `CSRFField` 返回包含 CSRF 令牌的隐藏表单字段，模板中为 `{{ csrf_field .request }}`。
+func CSRFField(r *http.Request) (template.HTML, error) {
+	cc, ok := r.Context().Value(csrfKey{}).(*csrfContext)
+	if !ok {
+		return "", errors.New("server: csrf middleware not in use")
+	}
+	return template.HTML(`<input type="hidden" name="` + template.HTMLEscapeString(cc.field) +
+		`" value="` + maskToken(cc.secret) + `">`), nil
+}
@@ -0,0 +1,169 @@
+package server
+
+import (
+	"context"
+	"gosurf/template"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"testing"
+)
+
+func TestCSRF(t *testing.T) {
+	dir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(dir, "form.html"), []byte(`<form>{{ csrf_field .request }}</form>{{ csrf_token .request }}`), 0644); err != nil {
+		t.Fatal(err)
+	}
+	old := template.TmplDir()
+	t.Cleanup(func() { template.SetTmplDir(old) })
+	template.SetTmplDir(dir)
+
+	p := NewProxy(context.Background(), ":0", nil)
+	p.Set403(func(w http.ResponseWriter, r *http.Request) { http.Error(w, "custom 403", 403) })
+	api := p.Group(`/api`)
+	hooks := p.Group(`/hooks`)
+	p.Use(p.CSRF(CSRFConfig{
+		Key:            []byte("secret"),
+		TrustedOrigins: []string{"https://admin.example.com"},
+		ExemptRoutes:   []string{"webhook"},
+		ExemptGroups:   []*Group{api},
+		Exempt:         func(r *http.Request) bool { return r.Header.Get("X-Internal") == "1" },
+	}))
+	p.Handle(`/form/`, View{
+		Get: func(w http.ResponseWriter, r *http.Request) {
+			if err := template.RenderWithRequest(w, r, "form.html", nil); err != nil {
+				t.Error(err)
+			}
+		},
+		Post: nameHandler("posted").ServeHTTP,
+	})
+	p.Handle(`/webhook/`, View{Name: "webhook", Post: nameHandler("webhook").ServeHTTP})
+	api.Handle(`/json/`, View{Post: nameHandler("json").ServeHTTP})
+	hooks.Handle(`/x/`, View{Post: nameHandler("hooks").ServeHTTP})
+
+	w := serve(p, "GET", "/form/")
+	cookies := w.Result().Cookies()
+	if len(cookies) != 1 || cookies[0].Name != "csrf_token" || !cookies[0].HttpOnly || cookies[0].SameSite != http.SameSiteLaxMode {
+		t.Fatalf("unexpected cookies %v", cookies)
+	}
+	cookie := cookies[0]
+	m := regexp.MustCompile(`^<form><input type="hidden" name="csrf_token" value="([-_A-Za-z0-9]+)"></form>([-_A-Za-z0-9]+)$`).FindStringSubmatch(w.Body.String())
+	if m == nil {
+		t.Fatalf("unexpected body %q", w.Body.String())
+	}
+	field, token := m[1], m[2]
+	if field == token {
+		t.Error("tokens should be masked differently on each call")
+	}
+
+	post := func(target string, cookie *http.Cookie, form url.Values, header ...string) *httptest.ResponseRecorder {
+		r := httptest.NewRequest("POST", target, strings.NewReader(form.Encode()))
+		r.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		if cookie != nil {
+			r.AddCookie(cookie)
+		}
+		for i := 0; i < len(header); i += 2 {
+			r.Header.Set(header[i], header[i+1])
+		}
+		w := httptest.NewRecorder()
+		p.ServeHTTP(w, r)
+		return w
+	}
+
+	if w := post("/form/", cookie, url.Values{"csrf_token": {field}}); w.Body.String() != "posted" {
+		t.Errorf("expect form token accepted, got %q", w.Body.String())
+	}
+	if w := post("/form/", cookie, nil, "X-CSRF-Token", token); w.Body.String() != "posted" {
+		t.Errorf("expect header token accepted, got %q", w.Body.String())
+	}
+	if w := post("/form/", cookie, nil); w.Body.String() != "custom 403\n" {
+		t.Errorf("expect 403 without token, got %q", w.Body.String())
+	}
+	if w := post("/form/", nil, url.Values{"csrf_token": {field}}); w.Code != http.StatusForbidden {
+		t.Errorf("expect 403 without cookie, got %d", w.Code)
+	}
+
+	// 伪造的 Cookie 签名无效，不会被接受
+	other := serve(p, "GET", "/form/").Result().Cookies()[0]
+	forged := &http.Cookie{Name: "csrf_token", Value: strings.Split(other.Value, ".")[0] + "." + strings.Split(cookie.Value, ".")[1]}
+	if w := post("/form/", forged, url.Values{"csrf_token": {field}}); w.Code != http.StatusForbidden {
+		t.Errorf("expect 403 with forged cookie, got %d", w.Code)
+	}
+	if w := post("/form/", other, url.Values{"csrf_token": {field}}); w.Code != http.StatusForbidden {
+		t.Errorf("expect 403 with token of another cookie, got %d", w.Code)
+	}
+
+	// 豁免的路由、路由组及自定义方法
+	for target, body := range map[string]string{"/webhook/": "webhook", "/api/json/": "json"} {
+		if w := post(target, nil, nil); w.Body.String() != body {
+			t.Errorf("%s: expect exempt, got %q", target, w.Body.String())
+		}
+	}
+	if w := post("/hooks/x/", nil, nil); w.Code != http.StatusForbidden {
+		t.Errorf("expect 403 for group not exempt, got %d", w.Code)
+	}
+	if w := post("/hooks/x/", nil, nil, "X-Internal", "1"); w.Body.String() != "hooks" {
+		t.Errorf("expect exempt by predicate, got %q", w.Body.String())
+	}
+
+	// HTTPS 请求检查来源
+	for _, c := range []struct {
+		header []string
+		ok     bool
+	}{
+		{[]string{"Origin", "https://example.com"}, true},
+		{[]string{"Origin", "https://admin.example.com"}, true},
+		{[]string{"Referer", "https://example.com/form/"}, true},
+		{[]string{"Origin", "https://evil.com"}, false},
+		{[]string{"Origin", "http://example.com"}, false},
+		{[]string{"Referer", "https://evil.com/form/"}, false},
+		{nil, false},
+	} {
+		w := post("https://example.com/form/", cookie, url.Values{"csrf_token": {field}}, c.header...)
+		if ok := w.Body.String() == "posted"; ok != c.ok {
+			t.Errorf("%v: expect ok=%v, got %d %q", c.header, c.ok, w.Code, w.Body.String())
+		}
+	}
+}
+
+func TestCSRFSecure(t *testing.T) {
+	p := NewProxy(context.Background(), ":0", nil)
+	p.Use(p.CSRF(CSRFConfig{Key: []byte("secret"), Secure: true}))
+	p.Handle(`/form/`, View{
+		Get: func(w http.ResponseWriter, r *http.Request) {
+			token, _ := CSRFToken(r)
+			w.Write([]byte(token))
+		},
+		Post: nameHandler("posted").ServeHTTP,
+	})
+
+	// 反向代理终止 TLS 时请求为 HTTP，仍按 HTTPS 处理
+	w := serve(p, "GET", "/form/")
+	cookie := w.Result().Cookies()[0]
+	if !cookie.Secure {
+		t.Error("expect secure cookie")
+	}
+	for origin, ok := range map[string]bool{"https://example.com": true, "https://evil.com": false, "": false} {
+		r := httptest.NewRequest("POST", "/form/", nil)
+		r.AddCookie(cookie)
+		r.Header.Set("X-CSRF-Token", w.Body.String())
+		if origin != "" {
+			r.Header.Set("Origin", origin)
+		}
+		rw := httptest.NewRecorder()
+		p.ServeHTTP(rw, r)
+		if (rw.Body.String() == "posted") != ok {
+			t.Errorf("%q: expect ok=%v, got %d", origin, ok, rw.Code)
+		}
+	}
+}
+
+func TestCSRFTemplateWithoutMiddleware(t *testing.T) {
+	if _, err := CSRFToken(httptest.NewRequest("GET", "/", nil)); err == nil {
+		t.Error("expect error without middleware")
+	}
+}
@@ -0,0 +1,215 @@
+// `debug.go` 实现了开发环境使用的错误页面。
+// 调试模式仅能通过 `WithDebug(true)` 显式开启，开启后发生 panic 时不再调用 `func500`，
+// 而是输出包含 panic 信息、调用栈及源码片段、请求头、表单、路由参数以及路由表的 HTML 页面。
+// 错误页面会泄露源码及请求内容，切勿在生产环境中开启。
+package server
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"html/template"
+	"net/http"
+	"os"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// 源码片段中出错行前后显示的行数
+const debugContextLines = 5
+
+// `WithDebug` 开启或关闭调试模式，默认关闭。
+func WithDebug(on bool) Option {
+	return func(p *Proxy) { p.debug = on }
+}
+
+type stackFrame struct {
+	Func   string
+	File   string
+	Line   int
+	Source []sourceLine
+}
+
+type sourceLine struct {
+	No      int
+	Text    string
+	Current bool
+}
+
+type debugRoute struct {
+	Name     string
+	Pattern  string
+	Priority int
+	Handler  string
+}
+
+type debugPage struct {
+	Err     string
+	Type    string
+	Method  string
+	URL     string
+	Stack   []stackFrame
+	Header  map[string][]string
+	Form    map[string][]string
+	Params  map[string]string
+	Routes  []debugRoute
+	Matched string
+}
+
+// `parseStack` 解析 `debug.Stack` 的输出，跳过 panic 处理相关的运行时帧。
+func parseStack(stack []byte) []stackFrame {
+	var frames []stackFrame
+	lines := strings.Split(string(stack), "\n")
+	for i := 1; i+1 < len(lines); i += 2 {
+		fn, loc := lines[i], strings.TrimSpace(lines[i+1])
+		if fn == "" || !strings.HasPrefix(lines[i+1], "\t") {
+			break
+		}
+		if j := strings.LastIndex(loc, " +0x"); j >= 0 {
+			loc = loc[:j]
+		}
+		j := strings.LastIndexByte(loc, ':')
+		if j < 0 {
+			continue
+		}
+		line, _ := strconv.Atoi(loc[j+1:])
+		f := stackFrame{Func: fn, File: loc[:j], Line: line}
+		if strings.HasPrefix(fn, "runtime/debug.Stack(") || strings.HasPrefix(fn, "panic(") ||
+			strings.HasPrefix(fn, "gosurf/server.(*Proxy).recoverHTTP(") {
+			continue
+		}
+		f.Source = readSource(f.File, f.Line)
+		frames = append(frames, f)
+	}
+	return frames
+}
+
+// `readSource` 读取出错行前后的源码，文件不存在（如部署环境中）时返回 `nil`。
+func readSource(file string, line int) []sourceLine {
+	fp, err := os.Open(file)
+	if err != nil {
+		return nil
+	}
+	defer fp.Close()
+
+	var src []sourceLine
+	sc := bufio.NewScanner(fp)
+	for no := 1; sc.Scan() && no <= line+debugContextLines; no++ {
+		if no >= line-debugContextLines {
+			src = append(src, sourceLine{No: no, Text: sc.Text(), Current: no == line})
+		}
+	}
+	return src
+}
+
+func (p *Proxy) serveDebug(w http.ResponseWriter, r *http.Request, err interface{}, stack []byte) {
+	page := debugPage{
+		Err:    fmt.Sprint(err),
+		Type:   fmt.Sprintf("%T", err),
+		Method: r.Method,
+		URL:    r.URL.String(),
+		Stack:  parseStack(stack),
+		Header: r.Header,
+	}
+	if r.Form == nil {
+		r.ParseForm()
+	}
+	page.Form = r.Form
+	if pm, ok := r.Context().Value(CtxParamKey).(*Params); ok {
+		page.Params = make(map[string]string, len(pm.m))
+		for k, v := range pm.m {
+			if k != "" {
+				page.Params[k] = v
+			}
+		}
+	}
+
+	p.rw.RLock()
+	routes := make([]*route, 0, len(p.router.routes))
+	for _, rt := range p.router.routes {
+		routes = append(routes, rt)
+	}
+	if rt, _ := p.router.match(r); rt != nil {
+		page.Matched = rt.pattern
+	}
+	p.rw.RUnlock()
+	sort.Slice(routes, func(i, j int) bool { return routes[i].before(routes[j]) })
+	for _, rt := range routes {
+		page.Routes = append(page.Routes, debugRoute{
+			Name:     rt.name,
+			Pattern:  rt.pattern,
+			Priority: rt.priority,
+			Handler:  reflect.TypeOf(rt.handler).String(),
+		})
+	}
+
+	var buf bytes.Buffer
+	if err := debugTemplate.Execute(&buf, page); err != nil {
+		http.Error(w, "500 internal error", http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.Header().Set("Cache-Control", "no-store")
+	w.WriteHeader(http.StatusInternalServerError)
+	buf.WriteTo(w)
+}
+
+var debugTemplate = template.Must(template.New("debug").Parse(`<!DOCTYPE html>
+<html>
+<head>
+<meta charset="utf-8">
+<title>panic: {{.Err}}</title>
+<style>
+body { font: 14px/1.5 sans-serif; margin: 0; color: #222; }
+header { background: #c62828; color: #fff; padding: 16px 24px; }
+header h1 { margin: 0; font-size: 20px; word-break: break-all; }
+section { padding: 8px 24px; }
+h2 { font-size: 16px; border-bottom: 1px solid #ddd; }
+table { border-collapse: collapse; width: 100%; }
+td, th { text-align: left; vertical-align: top; padding: 2px 8px; border-bottom: 1px solid #eee; font-family: monospace; }
+.frame { margin-bottom: 12px; }
+.func { font-family: monospace; font-weight: bold; }
+.file { font-family: monospace; color: #666; }
+pre { background: #f6f6f6; margin: 4px 0; padding: 4px 0; overflow-x: auto; }
+pre span { display: block; padding: 0 8px; }
+pre .current { background: #ffcdd2; }
+.matched { background: #fff9c4; }
+</style>
+</head>
+<body>
+<header>
+<h1>panic: {{.Err}}</h1>
+<div>{{.Type}} &middot; {{.Method}} {{.URL}}</div>
+</header>
+<section>
+<h2>Stack</h2>
+{{range .Stack}}<div class="frame">
+<div class="func">{{.Func}}</div>
+<div class="file">{{.File}}:{{.Line}}</div>
+{{if .Source}}<pre>{{range .Source}}<span{{if .Current}} class="current"{{end}}>{{printf "%5d" .No}}  {{.Text}}</span>{{end}}</pre>{{end}}
+</div>
+{{end}}</section>
+<section>
+<h2>Params</h2>
+<table>{{range $k, $v := .Params}}<tr><th>{{$k}}</th><td>{{$v}}</td></tr>{{end}}</table>
+</section>
+<section>
+<h2>Form</h2>
+<table>{{range $k, $v := .Form}}<tr><th>{{$k}}</th><td>{{range $v}}{{.}}<br>{{end}}</td></tr>{{end}}</table>
+</section>
+<section>
+<h2>Headers</h2>
+<table>{{range $k, $v := .Header}}<tr><th>{{$k}}</th><td>{{range $v}}{{.}}<br>{{end}}</td></tr>{{end}}</table>
+</section>
+<section>
+<h2>Routes</h2>
+<table>
+<tr><th>Name</th><th>Pattern</th><th>Priority</th><th>Handler</th></tr>
+{{range .Routes}}<tr{{if eq .Pattern $.Matched}} class="matched"{{end}}><td>{{.Name}}</td><td>{{.Pattern}}</td><td>{{.Priority}}</td><td>{{.Handler}}</td></tr>
+{{end}}</table>
+</section>
+</body>
+</html>
+`))
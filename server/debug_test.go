@@ -0,0 +1,51 @@
+package server
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestDebugPage(t *testing.T) {
+	boom := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		panic("<boom>")
+	})
+
+	p := NewProxy(context.Background(), ":0", nil)
+	p.Handle(`/user/{id:int}/`, View{Name: "user", Get: boom})
+	if w := serve(p, "GET", "/user/7/"); w.Body.String() != "500 internal error\n" {
+		t.Fatalf("debug page should be off by default, got %q", w.Body.String())
+	}
+
+	p.Configure(WithDebug(true))
+	r := httptest.NewRequest("GET", "/user/7/?q=term", nil)
+	r.Header.Set("X-Debug-Header", "header-value")
+	w := httptest.NewRecorder()
+	p.ServeHTTP(w, r)
+
+	if w.Code != http.StatusInternalServerError {
+		t.Errorf("expect 500, got %d", w.Code)
+	}
+	if ct := w.Header().Get("Content-Type"); !strings.HasPrefix(ct, "text/html") {
+		t.Errorf("unexpected content type %q", ct)
+	}
+	body := w.Body.String()
+	for _, s := range []string{
+		"panic: &lt;boom&gt;",
+		"debug_test.go",
+		`panic(&#34;&lt;boom&gt;&#34;)`,
+		"X-Debug-Header", "header-value",
+		"<th>q</th><td>term<br>",
+		"<th>id</th><td>7</td>",
+		`class="matched"><td>user</td>`,
+	} {
+		if !strings.Contains(body, s) {
+			t.Errorf("missing %q in debug page", s)
+		}
+	}
+	if strings.Contains(body, "runtime/debug.Stack") {
+		t.Error("debug page should skip the recover frames")
+	}
+}
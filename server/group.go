@@ -0,0 +1,60 @@
+// `group.go` 实现了路由组，组内注册的路由共享路径前缀及中间件，路由组可以嵌套。
+// 前缀与路由一样按 `URL.Path` 或 `Host + URL.Path` 匹配，
+// 因此以域名开头的前缀（如 `example.com/api`）即可将组内路由限定在该域名下。
+package server
+
+import (
+	"net/http"
+	"strings"
+)
+
+type Group struct {
+	proxy  *Proxy
+	parent *Group
+	prefix string
+	mws    []Middleware
+}
+
+// `Group` 创建路由组，组内路由的正则表达式会在前面加上 `prefix`。
+func (p *Proxy) Group(prefix string, mw ...Middleware) *Group {
+	if strings.HasSuffix(prefix, "$") {
+		panic("server: group prefix can not end with $")
+	}
+	return &Group{proxy: p, prefix: prefix, mws: mw}
+}
+
+// `Group` 创建嵌套的路由组，继承当前组的前缀及中间件。
+func (g *Group) Group(prefix string, mw ...Middleware) *Group {
+	if strings.HasSuffix(prefix, "$") {
+		panic("server: group prefix can not end with $")
+	}
+	return &Group{proxy: g.proxy, parent: g, prefix: joinPattern(g.prefix, prefix), mws: mw}
+}
+
+// `Use` 为路由组添加中间件，对组内（包括嵌套组内）已注册及之后注册的路由生效。
+func (g *Group) Use(mw ...Middleware) {
+	g.proxy.rw.Lock()
+	defer g.proxy.rw.Unlock()
+	g.mws = append(g.mws, mw...)
+	g.proxy.composeAll()
+}
+
+func (g *Group) Handle(pattern string, handler http.Handler) {
+	g.HandlePriority(pattern, 0, handler)
+}
+
+func (g *Group) HandlePriority(pattern string, priority int, handler http.Handler) {
+	g.proxy.handle(&route{raw: joinPattern(g.prefix, pattern), handler: handler, priority: priority, group: g})
+}
+
+func (g *Group) HandleWith(pattern string, handler http.Handler, mw ...Middleware) {
+	g.proxy.handle(&route{raw: joinPattern(g.prefix, pattern), handler: handler, mws: mw, group: g})
+}
+
+func joinPattern(prefix, pattern string) string {
+	pattern = strings.TrimPrefix(pattern, "^")
+	if strings.HasSuffix(prefix, "/") && strings.HasPrefix(pattern, "/") {
+		pattern = pattern[1:]
+	}
+	return prefix + pattern
+}
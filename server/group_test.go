@@ -0,0 +1,52 @@
+package server
+
+import (
+	"context"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestGroup(t *testing.T) {
+	var calls []string
+	p := NewProxy(context.Background(), ":0", nil)
+	api := p.Group("/api", tag("api", &calls))
+	api.Handle(`/logout/`, View{Name: "logout_api", Get: nameHandler("logout").ServeHTTP})
+	v1 := api.Group("/v1/", tag("v1", &calls))
+	v1.HandleWith(`/user/(?P<id>\d+)`, nameHandler("user"), tag("route", &calls))
+
+	if body := serve(p, "GET", "/api/logout").Body.String(); body != "logout" {
+		t.Errorf("expect logout, got %q", body)
+	}
+	if s := strings.Join(calls, ","); s != "api" {
+		t.Errorf("unexpected middleware %s", s)
+	}
+
+	calls = nil
+	if body := serve(p, "GET", "/api/v1/user/7/").Body.String(); body != "user" {
+		t.Errorf("expect user, got %q", body)
+	}
+	if s := strings.Join(calls, ","); s != "api,v1,route" {
+		t.Errorf("unexpected middleware %s", s)
+	}
+
+	if url, err := p.Reverse("logout_api"); err != nil || url != "/api/logout/" {
+		t.Errorf("expect /api/logout/, got %q (%v)", url, err)
+	}
+}
+
+func TestGroupHost(t *testing.T) {
+	p := NewProxy(context.Background(), ":0", nil)
+	p.Group(`admin\.example\.com`).Handle(`/`, nameHandler("admin"))
+
+	r := httptest.NewRequest("GET", "/", nil)
+	r.Host = "admin.example.com"
+	w := httptest.NewRecorder()
+	p.ServeHTTP(w, r)
+	if body := w.Body.String(); body != "admin" {
+		t.Errorf("expect admin, got %q", body)
+	}
+	if code := serve(p, "GET", "/").Code; code != 404 {
+		t.Errorf("expect 404, got %d", code)
+	}
+}
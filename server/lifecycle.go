@@ -0,0 +1,208 @@
+// `lifecycle.go` 管理服务器的启动与优雅关闭。
+// `Run` 同步监听地址并在后台处理请求，`Shutdown` 停止接受新连接并在期限内等待处理中的请求完成，
+// 随后停止追踪并按注册顺序的逆序执行 `OnShutdown` 注册的方法。
+package server
+
+import (
+	"context"
+	"io"
+	"net"
+	"net/http"
+	"os"
+	"os/signal"
+	"strings"
+	"syscall"
+	"time"
+)
+
+const defaultDrainTimeout = 30 * time.Second
+
+// `Run` 监听 `address` 并在后台处理请求，监听失败（如端口被占用）时直接返回错误，
+// 服务器已关闭时返回 `http.ErrServerClosed`。
+// `address` 可以包含以逗号分隔的多个地址，地址格式参见 `Listen`。
+func (p *Proxy) Run() error {
+	p.rw.RLock()
+	addr, mode, closed := p.address, p.socketMode, p.closed
+	p.rw.RUnlock()
+	if closed {
+		return http.ErrServerClosed
+	}
+	if addr == "" {
+		addr = ":http"
+	}
+
+	var lns []net.Listener
+	for _, a := range strings.Split(addr, ",") {
+		ln, err := bind(strings.TrimSpace(a), mode)
+		if err != nil {
+			for _, ln := range lns {
+				ln.Close()
+			}
+			return err
+		}
+		lns = append(lns, ln)
+	}
+
+	for i, ln := range lns {
+		if err := p.serve(ln, ln); err != nil {
+			for _, ln := range lns[i:] {
+				ln.Close()
+			}
+			return err
+		}
+	}
+	return nil
+}
+
+// `Serve` 在指定的 `net.Listener` 上处理请求，可多次调用以同时监听多个地址，
+// 服务器已关闭时返回 `http.ErrServerClosed`。
+func (p *Proxy) Serve(ln net.Listener) error {
+	return p.serve(ln, ln)
+}
+
+// `serve` 在 `ln` 上处理请求，`raw` 为未经 TLS 包装的原始监听，用于平滑重启时传给子进程。
+// 服务器已关闭时返回 `http.ErrServerClosed`，`ln` 由调用方关闭。
+func (p *Proxy) serve(ln, raw net.Listener) error {
+	p.rw.Lock()
+	defer p.rw.Unlock()
+	if p.closed {
+		return http.ErrServerClosed
+	}
+	defer notifyReady()
+
+	if p.srv == nil {
+		// make server
+		p.srv = p.newServer()
+	}
+	p.listeners = append(p.listeners, ln)
+	p.handoff = append(p.handoff, raw)
+
+	go func(srv *http.Server) {
+		if err := srv.Serve(ln); err != nil && err != http.ErrServerClosed {
+			select {
+			case p.errc <- err:
+			default:
+			}
+		}
+	}(p.srv)
+	return nil
+}
+
+// `Addrs` 返回服务器正在监听的地址。
+func (p *Proxy) Addrs() []net.Addr {
+	p.rw.RLock()
+	defer p.rw.RUnlock()
+	addrs := make([]net.Addr, len(p.listeners))
+	for i, ln := range p.listeners {
+		addrs[i] = ln.Addr()
+	}
+	return addrs
+}
+
+// `OnShutdown` 注册关闭服务器时执行的方法，如关闭数据库连接池、等待追踪信息处理完毕等。
+func (p *Proxy) OnShutdown(fn func()) {
+	p.rw.Lock()
+	defer p.rw.Unlock()
+	p.hooks = append(p.hooks, fn)
+}
+
+// `Shutdown` 优雅关闭服务器，`ctx` 到期时仍未完成的连接将被强制关闭并返回 `ctx.Err()`，
+// 阻塞的 `TraceSink` 同样不会使 `Shutdown` 超过 `ctx` 的期限。重复调用时直接返回第一次关闭的结果。
+func (p *Proxy) Shutdown(ctx context.Context) error {
+	p.rw.Lock()
+	if p.closed {
+		p.rw.Unlock()
+		<-p.done
+		return p.err
+	}
+	p.closed = true
+	srvs, hooks := p.servers, p.hooks
+	if p.srv != nil {
+		srvs = append([]*http.Server{p.srv}, srvs...)
+	}
+	p.rw.Unlock()
+
+	var err error
+	for _, srv := range srvs {
+		if e := srv.Shutdown(ctx); e != nil {
+			srv.Close()
+			if err == nil {
+				err = e
+			}
+		}
+	}
+
+	// 停止追踪，等待队列中的记录处理完毕后再关闭 `TraceSink`；
+	// `ctx` 结束时取消 `TraceSink` 的 context 并不再等待，`TraceSink` 在队列的 goroutine 退出后关闭
+	p.rw.Lock()
+	p.tracing = false
+	sink, queue := p.sink, p.queue
+	p.rw.Unlock()
+	closeSink := func() {
+		if c, ok := sink.(io.Closer); ok {
+			c.Close()
+		}
+	}
+	queue.close(ctx)
+	p.cancel()
+	if e := queue.wait(ctx); e != nil {
+		go func() {
+			queue.wait(context.Background())
+			closeSink()
+		}()
+		if err == nil {
+			err = e
+		}
+	} else {
+		closeSink()
+	}
+
+	p.rw.Lock()
+	p.err = err
+	p.rw.Unlock()
+
+	for i := len(hooks) - 1; i >= 0; i-- {
+		hooks[i]()
+	}
+
+	close(p.done)
+	return err
+}
+
+// `Stop` 使用默认的等待时间优雅关闭服务器。
+func (p *Proxy) Stop() {
+	p.rw.RLock()
+	timeout := p.drainTimeout
+	p.rw.RUnlock()
+
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+	p.Shutdown(ctx)
+}
+
+// `Wait` 阻塞直到服务器关闭完成或处理请求时出现错误，并返回相应的错误。
+func (p *Proxy) Wait() error {
+	select {
+	case <-p.done:
+		return p.err
+	case err := <-p.errc:
+		return err
+	}
+}
+
+// `HandleSignals` 在收到指定信号时优雅关闭服务器，未指定信号时监听 SIGINT 及 SIGTERM。
+func (p *Proxy) HandleSignals(sig ...os.Signal) {
+	if len(sig) == 0 {
+		sig = []os.Signal{os.Interrupt, syscall.SIGTERM}
+	}
+	c := make(chan os.Signal, 1)
+	signal.Notify(c, sig...)
+	go func() {
+		defer signal.Stop(c)
+		select {
+		case <-c:
+			p.Stop()
+		case <-p.done:
+		}
+	}()
+}
@@ -0,0 +1,111 @@
+package server
+
+import (
+	"context"
+	"crypto/tls"
+	"io"
+	"net/http"
+	"testing"
+	"time"
+)
+
+func TestRunBindError(t *testing.T) {
+	p := NewProxy(context.Background(), "127.0.0.1:0", nil)
+	if err := p.Run(); err != nil {
+		t.Fatal(err)
+	}
+	defer p.Stop()
+
+	q := NewProxy(context.Background(), p.Addrs()[0].String(), nil)
+	if err := q.Run(); err == nil {
+		q.Stop()
+		t.Error("expect bind error")
+	}
+}
+
+func TestRunAfterShutdown(t *testing.T) {
+	p := NewProxy(context.Background(), "127.0.0.1:0", nil)
+	if err := p.Shutdown(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+
+	for name, run := range map[string]func() error{
+		"Run":           p.Run,
+		"RunTLSConfig":  func() error { return p.RunTLSConfig(&tls.Config{}) },
+		"RedirectHTTPS": func() error { return p.RedirectHTTPS("127.0.0.1:0") },
+	} {
+		if err := run(); err != http.ErrServerClosed {
+			t.Errorf("%s: expect ErrServerClosed, got %v", name, err)
+		}
+	}
+	if addrs := p.Addrs(); len(addrs) != 0 {
+		t.Errorf("expect no listeners, got %v", addrs)
+	}
+}
+
+func TestShutdownDrain(t *testing.T) {
+	started := make(chan struct{})
+	p := NewProxy(context.Background(), "127.0.0.1:0", nil)
+	p.Handle(`/slow/`, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		close(started)
+		time.Sleep(100 * time.Millisecond)
+		w.Write([]byte("done"))
+	}))
+
+	var order []string
+	p.OnShutdown(func() { order = append(order, "first") })
+	p.OnShutdown(func() { order = append(order, "second") })
+
+	if err := p.Run(); err != nil {
+		t.Fatal(err)
+	}
+
+	result := make(chan string, 1)
+	go func() {
+		resp, err := http.Get("http://" + p.Addrs()[0].String() + "/slow/")
+		if err != nil {
+			result <- err.Error()
+			return
+		}
+		defer resp.Body.Close()
+		b, _ := io.ReadAll(resp.Body)
+		result <- string(b)
+	}()
+
+	<-started
+	if err := p.Shutdown(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if body := <-result; body != "done" {
+		t.Errorf("in-flight request should complete, got %q", body)
+	}
+	if len(order) != 2 || order[0] != "second" || order[1] != "first" {
+		t.Errorf("unexpected hook order %v", order)
+	}
+	if err := p.Wait(); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestShutdownDeadline(t *testing.T) {
+	started := make(chan struct{})
+	release := make(chan struct{})
+	p := NewProxy(context.Background(), "127.0.0.1:0", nil)
+	p.Handle(`/hang/`, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		close(started)
+		<-release
+	}))
+	if err := p.Run(); err != nil {
+		t.Fatal(err)
+	}
+	defer close(release)
+
+	go http.Get("http://" + p.Addrs()[0].String() + "/hang/")
+	<-started
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	if err := p.Shutdown(ctx); err != context.DeadlineExceeded {
+		t.Errorf("expect deadline exceeded, got %v", err)
+	}
+}
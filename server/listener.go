@@ -0,0 +1,175 @@
+// `listener.go` 实现了 TCP 以外的监听方式：Unix 域套接字以及继承自父进程的文件描述符
+// （如 systemd socket activation 通过 `LISTEN_FDS` 传入的套接字）。
+// 平滑重启时子进程通过 `GOSURF_LISTEN_FDS` 继承父进程的监听，`Run`、`RunTLS` 等方法
+// 会按父进程中的监听顺序依次取用，而不再重新监听地址。
+package server
+
+import (
+	"errors"
+	"net"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// `Listen` 根据地址格式创建监听：
+//
+//	unix:/run/app.sock  Unix 域套接字
+//	fd:3                继承的文件描述符
+//	:8080               TCP 地址
+func Listen(address string) (net.Listener, error) {
+	return listen(address, 0)
+}
+
+// `bind` 优先使用继承自父进程的监听，否则按地址新建监听。
+func bind(address string, mode os.FileMode) (net.Listener, error) {
+	if ln := takeInherited(); ln != nil {
+		return ln, nil
+	}
+	return listen(address, mode)
+}
+
+func listen(address string, mode os.FileMode) (net.Listener, error) {
+	switch {
+	case strings.HasPrefix(address, "unix:"):
+		return ListenUnix(strings.TrimPrefix(address, "unix:"), mode)
+	case strings.HasPrefix(address, "fd:"):
+		fd, err := strconv.Atoi(strings.TrimPrefix(address, "fd:"))
+		if err != nil || fd < 0 {
+			return nil, errors.New("server: invalid file descriptor address " + address)
+		}
+		return fileListener(uintptr(fd), address)
+	default:
+		return net.Listen("tcp", address)
+	}
+}
+
+// `ListenUnix` 监听 Unix 域套接字，`mode` 不为 0 时修改套接字文件的权限。
+// 若套接字文件已存在但无法连接（进程异常退出后残留），则删除后重新监听。
+func ListenUnix(path string, mode os.FileMode) (net.Listener, error) {
+	if fi, err := os.Lstat(path); err == nil {
+		if fi.Mode()&os.ModeSocket == 0 {
+			return nil, errors.New("server: " + path + " exists and is not a socket")
+		}
+		if conn, err := net.Dial("unix", path); err == nil {
+			conn.Close()
+			return nil, errors.New("server: " + path + " is in use")
+		}
+		if err := os.Remove(path); err != nil {
+			return nil, err
+		}
+	}
+
+	ln, err := net.Listen("unix", path)
+	if err != nil {
+		return nil, err
+	}
+	if mode != 0 {
+		if err := os.Chmod(path, mode); err != nil {
+			ln.Close()
+			return nil, err
+		}
+	}
+	return ln, nil
+}
+
+// systemd 传入的第一个文件描述符，测试时可修改
+var listenFdsStart = 3
+
+// `ListenFDs` 返回 systemd socket activation 传入的监听，
+// 未设置 `LISTEN_FDS` 或 `LISTEN_PID` 与当前进程不符时返回空。
+// 成功读取后清除 `LISTEN_FDS`、`LISTEN_PID` 及 `LISTEN_FDNAMES`，避免子进程或再次调用时重复使用这些文件描述符。
+func ListenFDs() ([]net.Listener, error) {
+	if pid := os.Getenv("LISTEN_PID"); pid != "" && pid != strconv.Itoa(os.Getpid()) {
+		return nil, nil
+	}
+	n, err := strconv.Atoi(os.Getenv("LISTEN_FDS"))
+	if err != nil || n <= 0 {
+		return nil, nil
+	}
+	names := strings.Split(os.Getenv("LISTEN_FDNAMES"), ":")
+
+	lns := make([]net.Listener, 0, n)
+	for i := 0; i < n; i++ {
+		name := "fd:" + strconv.Itoa(listenFdsStart+i)
+		if i < len(names) && names[i] != "" {
+			name = names[i]
+		}
+		ln, err := fileListener(uintptr(listenFdsStart+i), name)
+		if err != nil {
+			for _, ln := range lns {
+				ln.Close()
+			}
+			return nil, err
+		}
+		lns = append(lns, ln)
+	}
+	os.Unsetenv("LISTEN_FDS")
+	os.Unsetenv("LISTEN_PID")
+	os.Unsetenv("LISTEN_FDNAMES")
+	return lns, nil
+}
+
+func fileListener(fd uintptr, name string) (net.Listener, error) {
+	f := os.NewFile(fd, name)
+	if f == nil {
+		return nil, errors.New("server: invalid file descriptor " + name)
+	}
+	defer f.Close()
+	return net.FileListener(f)
+}
+
+const (
+	inheritFdsEnv = "GOSURF_LISTEN_FDS"
+	readyFdEnv    = "GOSURF_READY_FD"
+)
+
+// `inherit` 保存平滑重启时从父进程继承的监听，以及用于通知父进程子进程已就绪的管道。
+var inherit struct {
+	once  sync.Once
+	mu    sync.Mutex
+	lns   []net.Listener
+	ready *os.File
+}
+
+func loadInherited() {
+	inherit.once.Do(func() {
+		n, _ := strconv.Atoi(os.Getenv(inheritFdsEnv))
+		for i := 0; i < n; i++ {
+			if ln, err := fileListener(uintptr(3+i), "fd:"+strconv.Itoa(3+i)); err == nil {
+				inherit.lns = append(inherit.lns, ln)
+			}
+		}
+		if fd, err := strconv.Atoi(os.Getenv(readyFdEnv)); err == nil {
+			inherit.ready = os.NewFile(uintptr(fd), "ready")
+		}
+		os.Unsetenv(inheritFdsEnv)
+		os.Unsetenv(readyFdEnv)
+	})
+}
+
+func takeInherited() net.Listener {
+	loadInherited()
+	inherit.mu.Lock()
+	defer inherit.mu.Unlock()
+	if len(inherit.lns) == 0 {
+		return nil
+	}
+	ln := inherit.lns[0]
+	inherit.lns = inherit.lns[1:]
+	return ln
+}
+
+// `notifyReady` 在继承的监听全部投入使用后通知父进程，父进程随后开始优雅关闭。
+func notifyReady() {
+	loadInherited()
+	inherit.mu.Lock()
+	defer inherit.mu.Unlock()
+	if inherit.ready == nil || len(inherit.lns) > 0 {
+		return
+	}
+	inherit.ready.Write([]byte{1})
+	inherit.ready.Close()
+	inherit.ready = nil
+}
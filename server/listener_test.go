@@ -0,0 +1,106 @@
+package server
+
+import (
+	"context"
+	"io"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+	"testing"
+)
+
+func unixGet(t *testing.T, path, url string) string {
+	client := &http.Client{Transport: &http.Transport{
+		DialContext: func(ctx context.Context, _, _ string) (net.Conn, error) {
+			return new(net.Dialer).DialContext(ctx, "unix", path)
+		},
+	}}
+	resp, err := client.Get(url)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	b, _ := io.ReadAll(resp.Body)
+	return string(b)
+}
+
+func TestRunMultipleAddresses(t *testing.T) {
+	sock := filepath.Join(t.TempDir(), "app.sock")
+
+	// 残留的套接字文件
+	stale, err := net.Listen("unix", sock)
+	if err != nil {
+		t.Fatal(err)
+	}
+	stale.(*net.UnixListener).SetUnlinkOnClose(false)
+	stale.Close()
+
+	p := NewProxy(context.Background(), "127.0.0.1:0,unix:"+sock, nil, WithSocketMode(0660))
+	p.Handle(`/`, nameHandler("ok"))
+	if err := p.Run(); err != nil {
+		t.Fatal(err)
+	}
+
+	if fi, err := os.Stat(sock); err != nil || fi.Mode().Perm() != 0660 {
+		t.Errorf("unexpected socket mode %v (%v)", fi.Mode(), err)
+	}
+	if body := unixGet(t, sock, "http://unix/"); body != "ok" {
+		t.Errorf("expect ok, got %q", body)
+	}
+
+	addrs := p.Addrs()
+	if len(addrs) != 2 {
+		t.Fatalf("expect 2 listeners, got %v", addrs)
+	}
+	resp, err := http.Get("http://" + addrs[0].String() + "/")
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+
+	// 套接字正在使用时不会被删除
+	if _, err := ListenUnix(sock, 0); err == nil {
+		t.Error("expect in use error")
+	}
+
+	p.Stop()
+	if _, err := os.Stat(sock); !os.IsNotExist(err) {
+		t.Error("socket file should be removed after stop")
+	}
+}
+
+func TestServeFileDescriptor(t *testing.T) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ln.Close()
+	f, err := ln.(*net.TCPListener).File()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+
+	inherited, err := Listen("fd:" + strconv.Itoa(int(f.Fd())))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	p := NewProxy(context.Background(), "", nil)
+	p.Handle(`/`, nameHandler("fd"))
+	if err := p.Serve(inherited); err != nil {
+		t.Fatal(err)
+	}
+	defer p.Stop()
+
+	resp, err := http.Get("http://" + inherited.Addr().String() + "/")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	if b, _ := io.ReadAll(resp.Body); string(b) != "fd" {
+		t.Errorf("expect fd, got %q", b)
+	}
+}
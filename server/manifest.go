@@ -0,0 +1,175 @@
+// `manifest.go` 实现了带内容指纹的静态文件清单。
+// `BuildManifest` 扫描静态文件目录，为每个文件生成包含内容哈希的文件名（如 `app.js` 对应 `app.3f2a9c1b.js`），
+// 清单可以在构建时序列化为 JSON，运行时通过 `LoadManifest` 加载，省去启动时计算哈希的开销。
+// 静态文件处理方法使用 `Fingerprint` 选项后，带哈希的文件名将以永久缓存的方式返回，
+// 模板中通过 `{{static "app.js"}}` 获取带哈希的 URL，文件内容变化后 URL 随之变化。
+package server
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"io"
+	"io/fs"
+	"path"
+	"strings"
+	"sync"
+)
+
+// 带哈希文件名的 `Cache-Control`
+const immutableCacheControl = "public, max-age=31536000, immutable"
+
+// 文件名中哈希的长度（十六进制字符数）
+const fingerprintLen = 8
+
+type Manifest struct {
+	prefix string
+	// 原文件名到带哈希文件名的映射
+	files map[string]string
+	// 带哈希文件名到原文件名的映射
+	origins map[string]string
+}
+
+// `BuildManifest` 扫描 `fsys` 中的所有文件并生成清单，`prefix` 为静态文件路由的 URL 前缀（如 `/static/`）。
+// 预压缩文件（`.br`、`.gz`）跟随原文件，不单独生成哈希文件名。
+func BuildManifest(fsys fs.FS, prefix string) (*Manifest, error) {
+	files := make(map[string]string)
+	err := fs.WalkDir(fsys, ".", func(name string, d fs.DirEntry, err error) error {
+		if err != nil || d.IsDir() || isPrecompressed(name) {
+			return err
+		}
+
+		f, err := fsys.Open(name)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+
+		sum := sha256.New()
+		if _, err := io.Copy(sum, f); err != nil {
+			return err
+		}
+		files[name] = fingerprint(name, hex.EncodeToString(sum.Sum(nil))[:fingerprintLen])
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return newManifest(prefix, files), nil
+}
+
+// `LoadManifest` 读取 `WriteTo` 输出的 JSON 清单。
+func LoadManifest(r io.Reader, prefix string) (*Manifest, error) {
+	var files map[string]string
+	if err := json.NewDecoder(r).Decode(&files); err != nil {
+		return nil, errors.New("server: invalid manifest: " + err.Error())
+	}
+	for name, hashed := range files {
+		if !fs.ValidPath(name) || !fs.ValidPath(hashed) {
+			return nil, errors.New("server: invalid manifest entry " + name)
+		}
+	}
+	return newManifest(prefix, files), nil
+}
+
+func newManifest(prefix string, files map[string]string) *Manifest {
+	if !strings.HasSuffix(prefix, "/") {
+		prefix += "/"
+	}
+	m := &Manifest{prefix: prefix, files: files, origins: make(map[string]string, len(files))}
+	for name, hashed := range files {
+		m.origins[hashed] = name
+	}
+	return m
+}
+
+// `WriteTo` 将清单以 JSON 格式写入 `w`，键为原文件名，值为带哈希的文件名。
+func (m *Manifest) WriteTo(w io.Writer) (int64, error) {
+	b, err := json.MarshalIndent(m.files, "", "\t")
+	if err != nil {
+		return 0, err
+	}
+	n, err := w.Write(append(b, '\n'))
+	return int64(n), err
+}
+
+// `URL` 返回文件带哈希的 URL，文件不在清单中时返回错误。
+func (m *Manifest) URL(name string) (string, error) {
+	hashed, ok := m.files[strings.TrimPrefix(name, "/")]
+	if !ok {
+		return "", errors.New("server: static file " + name + " not in manifest")
+	}
+	return m.prefix + hashed, nil
+}
+
+// `origin` 返回带哈希文件名对应的原文件名，`current` 表示请求的哈希与清单中的一致。
+// 哈希不一致（如文件已更新）时返回原文件名及 `false`，文件名不带哈希或不在清单中时 `ok` 为 `false`。
+func (m *Manifest) origin(hashed string) (name string, current, ok bool) {
+	if name, ok := m.origins[hashed]; ok {
+		return name, true, true
+	}
+
+	ext := path.Ext(hashed)
+	stem := strings.TrimSuffix(hashed, ext)
+	hash := path.Ext(stem)
+	if len(hash) != fingerprintLen+1 {
+		return "", false, false
+	}
+	if _, err := hex.DecodeString(hash[1:]); err != nil {
+		return "", false, false
+	}
+	name = strings.TrimSuffix(stem, hash) + ext
+	if _, ok := m.files[name]; !ok {
+		return "", false, false
+	}
+	return name, false, true
+}
+
+// 模板方法 `static` 使用的清单
+var (
+	manifestMu sync.RWMutex
+	manifest   *Manifest
+)
+
+// `SetManifest` 设置模板方法 `static` 使用的清单。
+func SetManifest(m *Manifest) {
+	manifestMu.Lock()
+	defer manifestMu.Unlock()
+	manifest = m
+}
+
+// `StaticURL` 使用 `SetManifest` 或 `Fingerprint` 设置的清单返回文件带哈希的 URL，
+// 模板中为 `{{ static "app.js" }}`，未设置清单或文件不在清单中时返回错误。
+func StaticURL(name string) (string, error) {
+	manifestMu.RLock()
+	m := manifest
+	manifestMu.RUnlock()
+	if m == nil {
+		return "", errors.New("server: no manifest set for static " + name)
+	}
+	return m.URL(name)
+}
+
+// `Fingerprint` 使静态文件处理方法按清单响应带哈希的文件名，并设置永久缓存；原文件名仍可正常访问。
+// 请求的哈希与清单不一致时重定向到当前的 URL。
+// 同时将 `m` 设为模板方法 `static` 使用的清单，使用多个清单时以最后设置的为准。
+func Fingerprint(m *Manifest) StaticOption {
+	SetManifest(m)
+	return func(h *staticHandler) { h.manifest = m }
+}
+
+// `fingerprint` 在文件扩展名前插入哈希，如 `css/site.css` 变为 `css/site.3f2a9c1b.css`。
+func fingerprint(name, hash string) string {
+	ext := path.Ext(name)
+	return strings.TrimSuffix(name, ext) + "." + hash + ext
+}
+
+func isPrecompressed(name string) bool {
+	for _, pc := range precompressed {
+		if strings.HasSuffix(name, pc.ext) {
+			return true
+		}
+	}
+	return false
+}
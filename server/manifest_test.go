@@ -0,0 +1,95 @@
+package server
+
+import (
+	"bytes"
+	"context"
+	"gosurf/template"
+	"net/http"
+	"os"
+	"path/filepath"
+	"regexp"
+	"testing"
+	"testing/fstest"
+)
+
+func TestManifest(t *testing.T) {
+	fsys := fstest.MapFS{
+		"app.js":       {Data: []byte("console.log(1)")},
+		"app.js.br":    {Data: []byte("br-data")},
+		"css/site.css": {Data: []byte("body{}")},
+	}
+	m, err := BuildManifest(fsys, "/static")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	u, err := m.URL("app.js")
+	if err != nil || !regexp.MustCompile(`^/static/app\.[0-9a-f]{8}\.js$`).MatchString(u) {
+		t.Fatalf("unexpected url %q %v", u, err)
+	}
+	if _, err := m.URL("app.js.br"); err == nil {
+		t.Error("precompressed files should not be fingerprinted")
+	}
+	if _, err := m.URL("missing.js"); err == nil {
+		t.Error("expect error for missing file")
+	}
+
+	// 序列化后加载的清单与原清单一致
+	var buf bytes.Buffer
+	if _, err := m.WriteTo(&buf); err != nil {
+		t.Fatal(err)
+	}
+	loaded, err := LoadManifest(&buf, "/static/")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if lu, _ := loaded.URL("/app.js"); lu != u {
+		t.Errorf("expect %q after loading, got %q", u, lu)
+	}
+
+	t.Cleanup(func() { SetManifest(nil) })
+	p := NewProxy(context.Background(), ":0", nil)
+	p.Handle(`/static/(.+)`, p.ServeFS(fsys, Fingerprint(loaded), CacheControl(`.*`, "no-cache")))
+
+	w := serve(p, "GET", u)
+	if w.Code != http.StatusOK || w.Body.String() != "console.log(1)" {
+		t.Errorf("unexpected response %d %q", w.Code, w.Body.String())
+	}
+	if cc := w.Header().Get("Cache-Control"); cc != immutableCacheControl {
+		t.Errorf("unexpected Cache-Control %q", cc)
+	}
+	if w := serve(p, "GET", "/static/app.js"); w.Header().Get("Cache-Control") != "no-cache" {
+		t.Errorf("unexpected Cache-Control %q for original name", w.Header().Get("Cache-Control"))
+	}
+	// 过期的哈希重定向到当前的 URL，不设置永久缓存
+	w = serve(p, "GET", "/static/app.00000000.js?v=1")
+	if w.Code != http.StatusFound || w.Header().Get("Location") != u+"?v=1" || w.Header().Get("Cache-Control") != "" {
+		t.Errorf("expect redirect for stale hash, got %d %v", w.Code, w.Header())
+	}
+	if w := serve(p, "GET", "/static/missing.00000000.js"); w.Code != http.StatusNotFound {
+		t.Errorf("expect 404 for unknown file, got %d", w.Code)
+	}
+
+	// 模板方法 `static`
+	dir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(dir, "page.html"), []byte(`{{static "css/site.css"}}`), 0644); err != nil {
+		t.Fatal(err)
+	}
+	old := template.TmplDir()
+	t.Cleanup(func() { template.SetTmplDir(old) })
+	template.SetTmplDir(dir)
+	var out bytes.Buffer
+	if err := template.Render(&out, "page.html", nil); err != nil {
+		t.Fatal(err)
+	}
+	if !regexp.MustCompile(`^/static/css/site\.[0-9a-f]{8}\.css$`).MatchString(out.String()) {
+		t.Errorf("unexpected template output %q", out.String())
+	}
+}
+
+func TestStaticURLWithoutManifest(t *testing.T) {
+	SetManifest(nil)
+	if u, err := StaticURL("app.js"); err == nil {
+		t.Errorf("expect error without manifest, got %q", u)
+	}
+}
@@ -0,0 +1,161 @@
+// `metrics.go` 统计请求数量及耗时，并以 Prometheus 文本格式输出。
+// 请求按路由（名称及正则）和状态码类别（2xx、4xx 等）分别统计，
+// 同时统计处理中的请求数、`recoverHTTP` 捕获的 panic 数以及模板缓存的命中情况。
+package server
+
+import (
+	"bytes"
+	"gosurf/template"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"time"
+)
+
+// 耗时直方图的分桶上限（秒），与 Prometheus 客户端的默认值相同
+var latencyBuckets = []float64{.005, .01, .025, .05, .1, .25, .5, 1, 2.5, 5, 10}
+
+type histogram struct {
+	buckets []uint64
+	count   uint64
+	sum     uint64 // nanoseconds
+}
+
+func (h *histogram) observe(d time.Duration) {
+	s := d.Seconds()
+	for i, le := range latencyBuckets {
+		if s <= le {
+			atomic.AddUint64(&h.buckets[i], 1)
+		}
+	}
+	atomic.AddUint64(&h.sum, uint64(d))
+	atomic.AddUint64(&h.count, 1)
+}
+
+// `routeStats` 按状态码类别 1xx ~ 5xx 分别统计路由的请求。
+type routeStats struct {
+	classes [5]histogram
+}
+
+func newRouteStats() *routeStats {
+	rs := new(routeStats)
+	for i := range rs.classes {
+		rs.classes[i].buckets = make([]uint64, len(latencyBuckets))
+	}
+	return rs
+}
+
+func (rs *routeStats) observe(status int, d time.Duration) {
+	i := status/100 - 1
+	if i < 0 || i >= len(rs.classes) {
+		i = len(rs.classes) - 1
+	}
+	rs.classes[i].observe(d)
+}
+
+type metrics struct {
+	inFlight int64
+	panics   uint64
+	notFound *routeStats
+}
+
+func (p *Proxy) observe(rs *routeStats, w ResponseWriter, start time.Time) {
+	atomic.AddInt64(&p.metrics.inFlight, -1)
+	status := w.Status()
+	if status == 0 {
+		status = http.StatusOK
+	}
+	rs.observe(status, time.Since(start))
+}
+
+// `MetricsHandler` 返回以 Prometheus 文本格式输出统计信息的处理方法，
+// 可挂载到任意路由，如 `p.Handle("/metrics", p.MetricsHandler())`。
+func (p *Proxy) MetricsHandler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var buf bytes.Buffer
+		p.writeMetrics(&buf)
+		w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+		buf.WriteTo(w)
+	})
+}
+
+func (p *Proxy) writeMetrics(buf *bytes.Buffer) {
+	type series struct {
+		name, pattern string
+		stats         *routeStats
+	}
+
+	p.rw.RLock()
+	routes := make([]*route, 0, len(p.router.routes))
+	for _, rt := range p.router.routes {
+		routes = append(routes, rt)
+	}
+	p.rw.RUnlock()
+	sort.Slice(routes, func(i, j int) bool { return routes[i].seq < routes[j].seq })
+
+	all := make([]series, 0, len(routes)+1)
+	for _, rt := range routes {
+		all = append(all, series{rt.name, rt.pattern, rt.stats})
+	}
+	all = append(all, series{"", "", p.metrics.notFound})
+
+	buf.WriteString("# HELP gosurf_http_requests_total Total number of HTTP requests.\n")
+	buf.WriteString("# TYPE gosurf_http_requests_total counter\n")
+	for _, s := range all {
+		for i := range s.stats.classes {
+			if n := atomic.LoadUint64(&s.stats.classes[i].count); n > 0 {
+				buf.WriteString("gosurf_http_requests_total" + labels(s.name, s.pattern, i, "") + " " + strconv.FormatUint(n, 10) + "\n")
+			}
+		}
+	}
+
+	buf.WriteString("# HELP gosurf_http_request_duration_seconds HTTP request latency in seconds.\n")
+	buf.WriteString("# TYPE gosurf_http_request_duration_seconds histogram\n")
+	for _, s := range all {
+		for i := range s.stats.classes {
+			h := &s.stats.classes[i]
+			count := atomic.LoadUint64(&h.count)
+			if count == 0 {
+				continue
+			}
+			for j, le := range latencyBuckets {
+				n := atomic.LoadUint64(&h.buckets[j])
+				le := strconv.FormatFloat(le, 'g', -1, 64)
+				buf.WriteString("gosurf_http_request_duration_seconds_bucket" + labels(s.name, s.pattern, i, le) + " " + strconv.FormatUint(n, 10) + "\n")
+			}
+			buf.WriteString("gosurf_http_request_duration_seconds_bucket" + labels(s.name, s.pattern, i, "+Inf") + " " + strconv.FormatUint(count, 10) + "\n")
+			sum := time.Duration(atomic.LoadUint64(&h.sum)).Seconds()
+			buf.WriteString("gosurf_http_request_duration_seconds_sum" + labels(s.name, s.pattern, i, "") + " " + strconv.FormatFloat(sum, 'g', -1, 64) + "\n")
+			buf.WriteString("gosurf_http_request_duration_seconds_count" + labels(s.name, s.pattern, i, "") + " " + strconv.FormatUint(count, 10) + "\n")
+		}
+	}
+
+	buf.WriteString("# HELP gosurf_http_requests_in_flight Number of HTTP requests being served.\n")
+	buf.WriteString("# TYPE gosurf_http_requests_in_flight gauge\n")
+	buf.WriteString("gosurf_http_requests_in_flight " + strconv.FormatInt(atomic.LoadInt64(&p.metrics.inFlight), 10) + "\n")
+
+	buf.WriteString("# HELP gosurf_http_panics_total Total number of panics recovered while serving HTTP requests.\n")
+	buf.WriteString("# TYPE gosurf_http_panics_total counter\n")
+	buf.WriteString("gosurf_http_panics_total " + strconv.FormatUint(atomic.LoadUint64(&p.metrics.panics), 10) + "\n")
+
+	hits, misses := template.CacheStats()
+	buf.WriteString("# HELP gosurf_template_cache_hits_total Total number of template cache hits.\n")
+	buf.WriteString("# TYPE gosurf_template_cache_hits_total counter\n")
+	buf.WriteString("gosurf_template_cache_hits_total " + strconv.FormatUint(hits, 10) + "\n")
+	buf.WriteString("# HELP gosurf_template_cache_misses_total Total number of template cache misses.\n")
+	buf.WriteString("# TYPE gosurf_template_cache_misses_total counter\n")
+	buf.WriteString("gosurf_template_cache_misses_total " + strconv.FormatUint(misses, 10) + "\n")
+}
+
+var labelEscaper = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`)
+
+func labels(name, pattern string, class int, le string) string {
+	s := `{route="` + labelEscaper.Replace(name) + `",pattern="` + labelEscaper.Replace(pattern) +
+		`",code="` + strconv.Itoa(class+1) + `xx"`
+	if le != "" {
+		s += `,le="` + le + `"`
+	}
+	return s + "}"
+}
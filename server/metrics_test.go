@@ -0,0 +1,42 @@
+package server
+
+import (
+	"context"
+	"net/http"
+	"strings"
+	"testing"
+)
+
+func TestMetrics(t *testing.T) {
+	p := NewProxy(context.Background(), ":0", nil)
+	p.Handle(`/user/{id:int}/`, View{Name: "user", Get: nameHandler("user").ServeHTTP})
+	p.Handle(`/panic/`, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) { panic("boom") }))
+	p.Handle(`/metrics`, p.MetricsHandler())
+
+	serve(p, "GET", "/user/1/")
+	serve(p, "GET", "/user/2/")
+	serve(p, "POST", "/user/2/")
+	serve(p, "GET", "/panic/")
+	serve(p, "GET", "/missing/")
+
+	w := serve(p, "GET", "/metrics")
+	if ct := w.Header().Get("Content-Type"); !strings.HasPrefix(ct, "text/plain; version=0.0.4") {
+		t.Errorf("unexpected content type %q", ct)
+	}
+	body := w.Body.String()
+	for _, line := range []string{
+		`gosurf_http_requests_total{route="user",pattern="^/user/(?P<id>[0-9]+)/?$",code="2xx"} 2`,
+		`gosurf_http_requests_total{route="user",pattern="^/user/(?P<id>[0-9]+)/?$",code="4xx"} 1`,
+		`gosurf_http_requests_total{route="",pattern="^/panic/?$",code="5xx"} 1`,
+		`gosurf_http_requests_total{route="",pattern="",code="4xx"} 1`,
+		`gosurf_http_request_duration_seconds_bucket{route="user",pattern="^/user/(?P<id>[0-9]+)/?$",code="2xx",le="+Inf"} 2`,
+		`gosurf_http_request_duration_seconds_count{route="user",pattern="^/user/(?P<id>[0-9]+)/?$",code="2xx"} 2`,
+		"gosurf_http_requests_in_flight 1",
+		"gosurf_http_panics_total 1",
+		"# TYPE gosurf_template_cache_hits_total counter",
+	} {
+		if !strings.Contains(body, line+"\n") {
+			t.Errorf("missing %q in\n%s", line, body)
+		}
+	}
+}
@@ -0,0 +1,98 @@
+// `middleware.go` 实现了中间件链，请求依次经过全局、路由组（外层在前）及路由中间件，最后经 `recoverHTTP` 到达处理方法。
+// 未匹配任何路由的请求经过全局中间件后调用 `func404`。
+package server
+
+import "net/http"
+
+type Middleware func(http.Handler) http.Handler
+
+// `Use` 添加全局中间件，对已注册及之后注册的所有路由生效，先注册的在最外层。
+// 中间件位于 `recoverHTTP` 之外，能够看到 `func500` 写出的响应，其自身的 panic 由 `ServeHTTP` 最外层的 `recoverHTTP` 处理。
+func (p *Proxy) Use(mw ...Middleware) {
+	p.rw.Lock()
+	defer p.rw.Unlock()
+	p.mws = append(p.mws, mw...)
+	p.composeAll()
+}
+
+// `HandleWith` 注册路由，并为该路由单独添加中间件。
+func (p *Proxy) HandleWith(pattern string, handler http.Handler, mw ...Middleware) {
+	p.handle(&route{raw: pattern, handler: handler, mws: mw})
+}
+
+func wrap(h http.Handler, mws []Middleware) http.Handler {
+	for i := len(mws) - 1; i >= 0; i-- {
+		h = mws[i](h)
+	}
+	return h
+}
+
+// `compose` 生成路由的完整处理链，调用方需持有写锁。
+func (p *Proxy) compose(rt *route) {
+	h := p.recoverer(rt.handler)
+	h = wrap(h, rt.mws)
+	for g := rt.group; g != nil; g = g.parent {
+		h = wrap(h, g.mws)
+	}
+	rt.chain = wrap(h, p.mws)
+}
+
+// `composeAll` 重新生成所有路由及 404 的处理链，调用方需持有写锁。
+func (p *Proxy) composeAll() {
+	for _, rt := range p.router.routes {
+		p.compose(rt)
+	}
+	p.notFound = wrap(http.HandlerFunc(p.serve404), p.mws)
+}
+
+func (p *Proxy) recoverer(h http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		defer p.recoverHTTP(w, r)
+		h.ServeHTTP(w, r)
+	})
+}
+
+func (p *Proxy) serve403(w http.ResponseWriter, r *http.Request) {
+	p.rw.RLock()
+	func403 := p.func403
+	p.rw.RUnlock()
+
+	// call preset 403 function
+	func403(w, r)
+}
+
+func (p *Proxy) serve404(w http.ResponseWriter, r *http.Request) {
+	p.rw.RLock()
+	func404 := p.func404
+	p.rw.RUnlock()
+
+	// call preset 404 function
+	func404(w, r)
+}
+
+func (p *Proxy) serve405(w http.ResponseWriter, r *http.Request) {
+	p.rw.RLock()
+	func405 := p.func405
+	p.rw.RUnlock()
+
+	// call preset 405 function
+	func405(w, r)
+}
+
+func (p *Proxy) serve429(w http.ResponseWriter, r *http.Request) {
+	p.rw.RLock()
+	func429 := p.func429
+	p.rw.RUnlock()
+
+	// call preset 429 function
+	func429(w, r)
+}
+
+func (p *Proxy) serve500(w http.ResponseWriter, r *http.Request) {
+	p.rw.RLock()
+	func500 := p.func500
+	p.rw.RUnlock()
+
+	// call preset 500 function
+	func500(w, r)
+}
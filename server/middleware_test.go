@@ -0,0 +1,70 @@
+package server
+
+import (
+	"context"
+	"net/http"
+	"strings"
+	"testing"
+)
+
+func tag(name string, out *[]string) Middleware {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			*out = append(*out, name)
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+func TestMiddlewareOrder(t *testing.T) {
+	var calls []string
+	p := NewProxy(context.Background(), ":0", nil)
+	p.Use(tag("global1", &calls))
+	p.HandleWith(`/a/`, nameHandler("a"), tag("route", &calls))
+	// 在路由注册之后添加的全局中间件同样生效
+	p.Use(tag("global2", &calls))
+
+	serve(p, "GET", "/a/")
+	if s := strings.Join(calls, ","); s != "global1,global2,route" {
+		t.Errorf("unexpected order %s", s)
+	}
+
+	calls = nil
+	if code := serve(p, "GET", "/missing/").Code; code != http.StatusNotFound {
+		t.Errorf("expect 404, got %d", code)
+	}
+	if s := strings.Join(calls, ","); s != "global1,global2" {
+		t.Errorf("unexpected order %s", s)
+	}
+}
+
+func TestMiddlewareSeesRecoveredStatus(t *testing.T) {
+	var status int
+	p := NewProxy(context.Background(), ":0", nil)
+	p.Use(func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			next.ServeHTTP(w, r)
+			status = 200
+		})
+	})
+	p.Handle(`/panic/`, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) { panic("boom") }))
+
+	if code := serve(p, "GET", "/panic/").Code; code != http.StatusInternalServerError {
+		t.Errorf("expect 500, got %d", code)
+	}
+	if status != 200 {
+		t.Error("middleware should return normally after panic recovered")
+	}
+}
+
+func TestMiddlewarePanic(t *testing.T) {
+	p := NewProxy(context.Background(), ":0", nil)
+	p.Use(func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) { panic("boom") })
+	})
+	p.Handle(`/a/`, nameHandler("a"))
+
+	if code := serve(p, "GET", "/a/").Code; code != http.StatusInternalServerError {
+		t.Errorf("expect 500, got %d", code)
+	}
+}
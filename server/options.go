@@ -0,0 +1,136 @@
+// `options.go` 提供创建 `Proxy` 时的可选配置，以及针对单个路由调整读写期限的中间件。
+package server
+
+import (
+	"context"
+	"log"
+	"net"
+	"net/http"
+	"os"
+	"time"
+)
+
+type Option func(p *Proxy)
+
+// `serverOptions` 为生成 `http.Server` 时使用的配置。
+type serverOptions struct {
+	readTimeout       time.Duration
+	readHeaderTimeout time.Duration
+	writeTimeout      time.Duration
+	idleTimeout       time.Duration
+	maxHeaderBytes    int
+	errorLog          *log.Logger
+	connState         func(net.Conn, http.ConnState)
+	baseContext       func(net.Listener) context.Context
+}
+
+func defaultServerOptions() serverOptions {
+	return serverOptions{
+		readTimeout:  30 * time.Second,
+		writeTimeout: 30 * time.Second,
+	}
+}
+
+func (p *Proxy) newServer() *http.Server {
+	o := p.opts
+	return &http.Server{
+		Handler:           p,
+		ReadTimeout:       o.readTimeout,
+		ReadHeaderTimeout: o.readHeaderTimeout,
+		WriteTimeout:      o.writeTimeout,
+		IdleTimeout:       o.idleTimeout,
+		MaxHeaderBytes:    o.maxHeaderBytes,
+		ErrorLog:          o.errorLog,
+		ConnState:         o.connState,
+		BaseContext:       o.baseContext,
+	}
+}
+
+// `WithReadTimeout` 设置读取整个请求（包括请求体）的超时时间，默认 30 秒，0 表示不限制。
+func WithReadTimeout(d time.Duration) Option {
+	return func(p *Proxy) { p.opts.readTimeout = d }
+}
+
+// `WithReadHeaderTimeout` 设置读取请求头的超时时间，0 表示使用 `ReadTimeout`。
+func WithReadHeaderTimeout(d time.Duration) Option {
+	return func(p *Proxy) { p.opts.readHeaderTimeout = d }
+}
+
+// `WithWriteTimeout` 设置写响应的超时时间，默认 30 秒，0 表示不限制。
+// 需要长时间输出的路由（如文件导出、SSE）可以使用 `WriteDeadline` 中间件单独调整。
+func WithWriteTimeout(d time.Duration) Option {
+	return func(p *Proxy) { p.opts.writeTimeout = d }
+}
+
+// `WithIdleTimeout` 设置 keep-alive 连接的空闲超时时间，0 表示使用 `ReadTimeout`。
+func WithIdleTimeout(d time.Duration) Option {
+	return func(p *Proxy) { p.opts.idleTimeout = d }
+}
+
+// `WithMaxHeaderBytes` 设置请求头的最大字节数，0 表示使用 `http.DefaultMaxHeaderBytes`。
+func WithMaxHeaderBytes(n int) Option {
+	return func(p *Proxy) { p.opts.maxHeaderBytes = n }
+}
+
+func WithErrorLog(l *log.Logger) Option {
+	return func(p *Proxy) { p.opts.errorLog = l }
+}
+
+func WithConnState(fn func(net.Conn, http.ConnState)) Option {
+	return func(p *Proxy) { p.opts.connState = fn }
+}
+
+func WithBaseContext(fn func(net.Listener) context.Context) Option {
+	return func(p *Proxy) { p.opts.baseContext = fn }
+}
+
+// `WithDrainTimeout` 设置 `Stop` 等待处理中的请求完成的时间，默认 30 秒。
+func WithDrainTimeout(d time.Duration) Option {
+	return func(p *Proxy) { p.drainTimeout = d }
+}
+
+// `WithSocketMode` 设置 `Run` 创建的 Unix 域套接字文件的权限，0 表示使用默认权限。
+func WithSocketMode(mode os.FileMode) Option {
+	return func(p *Proxy) { p.socketMode = mode }
+}
+
+// `WithRestartCommand` 设置平滑重启时启动的命令，默认使用 `os.Args` 重新启动当前程序。
+func WithRestartCommand(args ...string) Option {
+	return func(p *Proxy) { p.restartArgs = args }
+}
+
+// `Configure` 修改配置，仅对之后启动的服务器生效。
+func (p *Proxy) Configure(opts ...Option) {
+	p.rw.Lock()
+	defer p.rw.Unlock()
+	for _, opt := range opts {
+		opt(p)
+	}
+}
+
+// `WriteDeadline` 返回为路由单独设置写响应期限的中间件，`d` 为 0 时取消期限。
+func WriteDeadline(d time.Duration) Middleware {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			http.NewResponseController(w).SetWriteDeadline(deadline(d))
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// `ReadDeadline` 返回为路由单独设置读取请求体期限的中间件，`d` 为 0 时取消期限。
+func ReadDeadline(d time.Duration) Middleware {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			http.NewResponseController(w).SetReadDeadline(deadline(d))
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+func deadline(d time.Duration) time.Time {
+	if d <= 0 {
+		return time.Time{}
+	}
+	return time.Now().Add(d)
+}
@@ -0,0 +1,40 @@
+package server
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"testing"
+	"time"
+)
+
+func TestWriteDeadline(t *testing.T) {
+	slow := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		time.Sleep(150 * time.Millisecond)
+		w.Write([]byte("done"))
+	})
+	p := NewProxy(context.Background(), "127.0.0.1:0", nil, WithWriteTimeout(50*time.Millisecond))
+	p.Handle(`/slow/`, slow)
+	p.HandleWith(`/export/`, slow, WriteDeadline(0))
+	if err := p.Run(); err != nil {
+		t.Fatal(err)
+	}
+	defer p.Stop()
+
+	get := func(path string) (string, error) {
+		resp, err := http.Get("http://" + p.Addrs()[0].String() + path)
+		if err != nil {
+			return "", err
+		}
+		defer resp.Body.Close()
+		b, err := io.ReadAll(resp.Body)
+		return string(b), err
+	}
+
+	if body, err := get("/slow/"); err == nil && body == "done" {
+		t.Error("expect server write timeout")
+	}
+	if body, err := get("/export/"); err != nil || body != "done" {
+		t.Errorf("expect done, got %q (%v)", body, err)
+	}
+}
@@ -0,0 +1,311 @@
+// `ratelimit.go` 实现了限流中间件，提供令牌桶及滑动窗口两种限流器。
+// 限流器的状态保存在 `util.AtomicStorage` 中，通过 `Update` 原子地更新，替换为共享的存储即可在多个进程间共享限流状态，
+// 此时存储需能够还原 `BucketState`、`WindowState` 类型的值（如使用 gob 编码并注册这两个类型），并保证 `Update` 的原子性。
+// 状态中记录了过期时间 `Expires`，过期的状态与不存在等价，限流器每分钟清理一次存储中过期的状态。
+// 请求按 `KeyFunc` 的返回值分别计数，内置按 IP、用户及路由区分，可通过 `KeyBy` 组合。
+// 响应带有 `RateLimit-Limit`、`RateLimit-Remaining`、`RateLimit-Reset` 头，
+// 超出限制时带有 `Retry-After` 头并调用所属 `Proxy` 的 `func429`。
+package server
+
+import (
+	"gosurf/util"
+	"math"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// `LimitResult` 为一次限流判断的结果。
+type LimitResult struct {
+	Allowed bool
+	// 配额上限
+	Limit int
+	// 剩余配额
+	Remaining int
+	// 配额完全恢复前的时间
+	Reset time.Duration
+	// 被拒绝时，下一次请求可被允许前的时间
+	RetryAfter time.Duration
+}
+
+// `Limiter` 为限流器，`Allow` 记录一次 `key` 的请求并返回判断结果，被拒绝的请求不计入配额。
+type Limiter interface {
+	Allow(key string) LimitResult
+}
+
+// 清理过期状态的间隔
+const limiterSweepInterval = time.Minute
+
+// `sweeper` 定期清理存储中过期的限流状态。
+type sweeper struct {
+	mu   sync.Mutex
+	next time.Time
+}
+
+type expirer interface {
+	expired(now time.Time) bool
+}
+
+// `maybeSweep` 距上次清理超过 `limiterSweepInterval` 时在新的 goroutine 中清理前缀为 `prefix` 的过期状态。
+func (sw *sweeper) maybeSweep(store util.AtomicStorage, prefix string, now time.Time) {
+	sw.mu.Lock()
+	due := !now.Before(sw.next)
+	if due {
+		sw.next = now.Add(limiterSweepInterval)
+	}
+	sw.mu.Unlock()
+	if due {
+		go sweep(store, prefix, now)
+	}
+}
+
+func sweep(store util.AtomicStorage, prefix string, now time.Time) {
+	store.Range(func(key, val interface{}) bool {
+		k, ok := key.(string)
+		if !ok || !strings.HasPrefix(k, prefix) {
+			return true
+		}
+		if e, ok := val.(expirer); ok && e.expired(now) {
+			store.Update(key, func(old interface{}) (interface{}, bool) {
+				e, ok := old.(expirer)
+				return old, !ok || !e.expired(now)
+			})
+		}
+		return true
+	})
+}
+
+// `BucketState` 为令牌桶的状态，`Expires` 为令牌桶补满的时间，之后该状态与不存在等价。
+type BucketState struct {
+	Tokens  float64
+	Last    time.Time
+	Expires time.Time
+}
+
+func (st BucketState) expired(now time.Time) bool { return !now.Before(st.Expires) }
+
+type tokenBucket struct {
+	rate  float64 // tokens per second
+	burst int
+	store util.AtomicStorage
+	sweep sweeper
+	now   func() time.Time
+}
+
+// `NewTokenBucket` 创建令牌桶限流器，每 `per` 时间补充 `rate` 个令牌，桶的容量为 `burst`（不大于 0 时为 `rate`），
+// `store` 为 `nil` 时使用 `util.NewSyncStorage`。
+func NewTokenBucket(rate int, per time.Duration, burst int, store util.AtomicStorage) Limiter {
+	if rate <= 0 || per <= 0 {
+		panic("server: invalid token bucket rate")
+	}
+	if burst <= 0 {
+		burst = rate
+	}
+	if store == nil {
+		store = util.NewSyncStorage().(util.AtomicStorage)
+	}
+	return &tokenBucket{rate: float64(rate) / per.Seconds(), burst: burst, store: store, now: time.Now}
+}
+
+func (tb *tokenBucket) Allow(key string) LimitResult {
+	now := tb.now()
+	tb.sweep.maybeSweep(tb.store, "tb:", now)
+
+	var res LimitResult
+	tb.store.Update("tb:"+key, func(old interface{}) (interface{}, bool) {
+		st, ok := old.(BucketState)
+		if !ok || st.expired(now) {
+			st = BucketState{Tokens: float64(tb.burst), Last: now}
+		}
+		if elapsed := now.Sub(st.Last).Seconds(); elapsed > 0 {
+			st.Tokens = math.Min(float64(tb.burst), st.Tokens+elapsed*tb.rate)
+		}
+		st.Last = now
+
+		res = LimitResult{Limit: tb.burst}
+		if st.Tokens >= 1 {
+			st.Tokens--
+			res.Allowed = true
+		} else {
+			res.RetryAfter = seconds((1 - st.Tokens) / tb.rate)
+		}
+		res.Remaining = int(st.Tokens)
+		res.Reset = seconds((float64(tb.burst) - st.Tokens) / tb.rate)
+		st.Expires = now.Add(res.Reset)
+		return st, true
+	})
+	return res
+}
+
+// `WindowState` 为滑动窗口的状态，`Expires` 为两个计数均已失效的时间，之后该状态与不存在等价。
+type WindowState struct {
+	Start   time.Time
+	Prev    int
+	Curr    int
+	Expires time.Time
+}
+
+func (st WindowState) expired(now time.Time) bool { return !now.Before(st.Expires) }
+
+type slidingWindow struct {
+	limit  int
+	window time.Duration
+	store  util.AtomicStorage
+	sweep  sweeper
+	now    func() time.Time
+}
+
+// `NewSlidingWindow` 创建滑动窗口限流器，任意 `window` 时间内最多允许 `limit` 次请求。
+// 窗口内的请求数由当前及上一个固定窗口的计数按时间比例估算，`store` 为 `nil` 时使用 `util.NewSyncStorage`。
+func NewSlidingWindow(limit int, window time.Duration, store util.AtomicStorage) Limiter {
+	if limit <= 0 || window <= 0 {
+		panic("server: invalid sliding window limit")
+	}
+	if store == nil {
+		store = util.NewSyncStorage().(util.AtomicStorage)
+	}
+	return &slidingWindow{limit: limit, window: window, store: store, now: time.Now}
+}
+
+func (sw *slidingWindow) Allow(key string) LimitResult {
+	now := sw.now()
+	sw.sweep.maybeSweep(sw.store, "sw:", now)
+
+	var res LimitResult
+	sw.store.Update("sw:"+key, func(old interface{}) (interface{}, bool) {
+		start := now.Truncate(sw.window)
+		st, _ := old.(WindowState)
+		switch {
+		case st.Start.Equal(start):
+		case st.Start.Add(sw.window).Equal(start):
+			st = WindowState{Start: start, Prev: st.Curr}
+		default:
+			st = WindowState{Start: start}
+		}
+		// 当前窗口的计数在下下个窗口开始时失效
+		st.Expires = start.Add(2 * sw.window)
+
+		w := float64(sw.window)
+		elapsed := float64(now.Sub(start))
+		estimate := float64(st.Prev)*(1-elapsed/w) + float64(st.Curr)
+
+		res = LimitResult{Limit: sw.limit, Reset: start.Add(sw.window).Sub(now)}
+		if estimate+1 <= float64(sw.limit) {
+			st.Curr++
+			estimate++
+			res.Allowed = true
+		} else {
+			// 估算值降至 `limit - 1` 以下所需的时间
+			free := float64(sw.limit - 1)
+			if st.Curr <= sw.limit-1 {
+				res.RetryAfter = time.Duration(w*(1-(free-float64(st.Curr))/float64(st.Prev)) - elapsed)
+			} else {
+				res.RetryAfter = time.Duration(w - elapsed + w*(1-free/float64(st.Curr)))
+			}
+		}
+		res.Remaining = sw.limit - int(math.Ceil(estimate))
+		if res.Remaining < 0 {
+			res.Remaining = 0
+		}
+		return st, true
+	})
+	return res
+}
+
+func seconds(s float64) time.Duration {
+	return time.Duration(s * float64(time.Second))
+}
+
+type KeyFunc func(r *http.Request) string
+
+// `KeyByIP` 按客户端 IP 区分请求，使用 `RemoteAddr`。
+// 位于反向代理之后时应使用解析 `X-Forwarded-For` 等请求头的自定义方法，且只信任代理添加的部分。
+func KeyByIP(r *http.Request) string {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return host
+}
+
+// `KeyByUser` 按 `user` 返回的用户标识区分请求，未登录（返回空字符串）时按 IP 区分。
+func KeyByUser(user func(r *http.Request) string) KeyFunc {
+	return func(r *http.Request) string {
+		if u := user(r); u != "" {
+			return "user:" + u
+		}
+		return "ip:" + KeyByIP(r)
+	}
+}
+
+// `KeyByRoute` 按匹配的路由（名称，未命名时为正则）区分请求，未匹配任何路由时返回空字符串。
+func (p *Proxy) KeyByRoute(r *http.Request) string {
+	p.rw.RLock()
+	rt, _ := p.router.match(r)
+	p.rw.RUnlock()
+	if rt == nil {
+		return ""
+	}
+	if rt.name != "" {
+		return rt.name
+	}
+	return rt.pattern
+}
+
+// `KeyBy` 组合多个 `KeyFunc`，如 `KeyBy(p.KeyByRoute, KeyByIP)` 按路由及 IP 分别计数。
+func KeyBy(fns ...KeyFunc) KeyFunc {
+	return func(r *http.Request) string {
+		keys := make([]string, len(fns))
+		for i, fn := range fns {
+			keys[i] = fn(r)
+		}
+		return strings.Join(keys, "|")
+	}
+}
+
+type RateLimitConfig struct {
+	// 限流器
+	Limiter Limiter
+	// 区分请求的方法，默认为 `KeyByIP`；共享同一个 `Storage` 的限流中间件应返回不同的 key
+	Key KeyFunc
+	// 不限流的请求，返回 `true` 时直接处理
+	Skip func(r *http.Request) bool
+}
+
+// `RateLimit` 返回限流中间件，通常用于单个路由或路由组，如
+// `p.HandleWith("/login/", login, p.RateLimit(RateLimitConfig{Limiter: NewSlidingWindow(5, time.Minute, nil)}))`。
+func (p *Proxy) RateLimit(cfg RateLimitConfig) Middleware {
+	if cfg.Limiter == nil {
+		panic("server: rate limit without limiter")
+	}
+	if cfg.Key == nil {
+		cfg.Key = KeyByIP
+	}
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if cfg.Skip != nil && cfg.Skip(r) {
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			res := cfg.Limiter.Allow(cfg.Key(r))
+			h := w.Header()
+			h.Set("RateLimit-Limit", strconv.Itoa(res.Limit))
+			h.Set("RateLimit-Remaining", strconv.Itoa(res.Remaining))
+			h.Set("RateLimit-Reset", ceilSeconds(res.Reset))
+			if !res.Allowed {
+				h.Set("Retry-After", ceilSeconds(res.RetryAfter))
+				p.serve429(w, r)
+				return
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+func ceilSeconds(d time.Duration) string {
+	return strconv.FormatInt(int64(math.Ceil(d.Seconds())), 10)
+}
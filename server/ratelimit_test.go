@@ -0,0 +1,178 @@
+package server
+
+import (
+	"context"
+	"gosurf/util"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+type fakeClock struct{ t time.Time }
+
+func (c *fakeClock) now() time.Time          { return c.t }
+func (c *fakeClock) advance(d time.Duration) { c.t = c.t.Add(d) }
+
+func TestTokenBucket(t *testing.T) {
+	clock := &fakeClock{time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)}
+	store := util.NewSyncStorage().(util.AtomicStorage)
+	tb := NewTokenBucket(1, time.Second, 3, store).(*tokenBucket)
+	tb.now = clock.now
+
+	for i := 2; i >= 0; i-- {
+		if res := tb.Allow("a"); !res.Allowed || res.Remaining != i || res.Limit != 3 {
+			t.Fatalf("expect allowed with %d remaining, got %+v", i, res)
+		}
+	}
+	res := tb.Allow("a")
+	if res.Allowed || res.RetryAfter != time.Second || res.Reset != 3*time.Second {
+		t.Errorf("expect denied, got %+v", res)
+	}
+	if !tb.Allow("b").Allowed {
+		t.Error("keys should be limited separately")
+	}
+
+	clock.advance(1500 * time.Millisecond)
+	if res := tb.Allow("a"); !res.Allowed || res.Remaining != 0 {
+		t.Errorf("expect refilled token, got %+v", res)
+	}
+	if res := tb.Allow("a"); res.Allowed || res.RetryAfter != 500*time.Millisecond {
+		t.Errorf("expect denied, got %+v", res)
+	}
+
+	// 状态保存在 `Storage` 中
+	if _, ok := store.Get("tb:a").(BucketState); !ok {
+		t.Error("expect state in storage")
+	}
+}
+
+func TestSlidingWindow(t *testing.T) {
+	clock := &fakeClock{time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)}
+	sw := NewSlidingWindow(4, time.Minute, nil).(*slidingWindow)
+	sw.now = clock.now
+
+	for i := 3; i >= 0; i-- {
+		if res := sw.Allow("a"); !res.Allowed || res.Remaining != i {
+			t.Fatalf("expect allowed with %d remaining, got %+v", i, res)
+		}
+	}
+	clock.advance(15 * time.Second)
+	res := sw.Allow("a")
+	// 进入下一个窗口后上一窗口的 4 次请求按比例计入，降至 3 次需要 60s - 45s + 15s
+	if res.Allowed || res.RetryAfter != 60*time.Second || res.Reset != 45*time.Second {
+		t.Errorf("expect denied, got %+v", res)
+	}
+
+	clock.advance(60 * time.Second)
+	// 上一窗口的权重为 45/60，估算值为 3
+	if res := sw.Allow("a"); !res.Allowed || res.Remaining != 0 {
+		t.Errorf("expect allowed, got %+v", res)
+	}
+	res = sw.Allow("a")
+	if res.Allowed || res.RetryAfter != 15*time.Second {
+		t.Errorf("expect denied, got %+v", res)
+	}
+
+	clock.advance(2 * time.Minute)
+	if res := sw.Allow("a"); !res.Allowed || res.Remaining != 3 {
+		t.Errorf("expect reset after idle windows, got %+v", res)
+	}
+}
+
+func TestLimiterEviction(t *testing.T) {
+	clock := &fakeClock{time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)}
+	store := util.NewSyncStorage().(util.AtomicStorage)
+	tb := NewTokenBucket(1, time.Second, 3, store).(*tokenBucket)
+	tb.now = clock.now
+	sw := NewSlidingWindow(4, time.Minute, store).(*slidingWindow)
+	sw.now = clock.now
+	store.Set("other", 1)
+
+	tb.Allow("a")
+	sw.Allow("a")
+	count := func() (n int) {
+		store.Range(func(key, val interface{}) bool { n++; return true })
+		return n
+	}
+
+	// 令牌桶 1s 后补满，滑动窗口的计数仍有效
+	clock.advance(time.Second)
+	sweep(store, "tb:", clock.now())
+	sweep(store, "sw:", clock.now())
+	if store.Get("tb:a") != nil || store.Get("sw:a") == nil {
+		t.Errorf("expect only refilled bucket evicted, %d keys left", count())
+	}
+
+	clock.advance(2 * time.Minute)
+	sweep(store, "sw:", clock.now())
+	if store.Get("sw:a") != nil || store.Get("other") != 1 {
+		t.Errorf("expect only stale window evicted, %d keys left", count())
+	}
+}
+
+func TestRateLimit(t *testing.T) {
+	p := NewProxy(context.Background(), ":0", nil)
+	p.Set429(func(w http.ResponseWriter, r *http.Request) { http.Error(w, "slow down", http.StatusTooManyRequests) })
+	limit := p.RateLimit(RateLimitConfig{
+		Limiter: NewSlidingWindow(2, time.Hour, nil),
+		Key:     KeyBy(p.KeyByRoute, KeyByIP),
+		Skip:    func(r *http.Request) bool { return r.Header.Get("X-Admin") == "1" },
+	})
+	p.HandleWith(`/login/`, View{Name: "login", Post: nameHandler("login").ServeHTTP}, limit)
+	p.HandleWith(`/email/`, View{Name: "email", Post: nameHandler("email").ServeHTTP}, limit)
+
+	post := func(target, ip string, header ...string) *httptest.ResponseRecorder {
+		r := httptest.NewRequest("POST", target, nil)
+		r.RemoteAddr = ip + ":1234"
+		for i := 0; i < len(header); i += 2 {
+			r.Header.Set(header[i], header[i+1])
+		}
+		w := httptest.NewRecorder()
+		p.ServeHTTP(w, r)
+		return w
+	}
+
+	for i := 0; i < 2; i++ {
+		if w := post("/login/", "10.0.0.1"); w.Body.String() != "login" {
+			t.Fatalf("expect allowed, got %q", w.Body.String())
+		}
+	}
+	w := post("/login/", "10.0.0.1")
+	if w.Code != http.StatusTooManyRequests || w.Body.String() != "slow down\n" {
+		t.Errorf("expect custom 429, got %d %q", w.Code, w.Body.String())
+	}
+	for k, v := range map[string]string{"RateLimit-Limit": "2", "RateLimit-Remaining": "0"} {
+		if got := w.Header().Get(k); got != v {
+			t.Errorf("%s: expect %q, got %q", k, v, got)
+		}
+	}
+	if w.Header().Get("Retry-After") == "" || w.Header().Get("RateLimit-Reset") == "" {
+		t.Errorf("missing headers %v", w.Header())
+	}
+
+	if w := post("/email/", "10.0.0.1"); w.Body.String() != "email" || w.Header().Get("RateLimit-Remaining") != "1" {
+		t.Errorf("routes should be limited separately, got %q %v", w.Body.String(), w.Header())
+	}
+	if w := post("/login/", "10.0.0.2"); w.Body.String() != "login" {
+		t.Errorf("IPs should be limited separately, got %q", w.Body.String())
+	}
+	if w := post("/login/", "10.0.0.1", "X-Admin", "1"); w.Body.String() != "login" || w.Header().Get("RateLimit-Limit") != "" {
+		t.Errorf("expect skipped, got %q", w.Body.String())
+	}
+}
+
+func TestKeyByUser(t *testing.T) {
+	key := KeyByUser(func(r *http.Request) string {
+		u, _, _ := r.BasicAuth()
+		return u
+	})
+	r := httptest.NewRequest("GET", "/", nil)
+	if k := key(r); k != "ip:192.0.2.1" {
+		t.Errorf("unexpected key %q", k)
+	}
+	r.SetBasicAuth("alice", "secret")
+	if k := key(r); k != "user:alice" {
+		t.Errorf("unexpected key %q", k)
+	}
+}
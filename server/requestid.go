@@ -0,0 +1,50 @@
+// `requestid.go` 实现了请求 ID 中间件。
+// 请求携带合法的 `X-Request-ID` 头时沿用该值，否则生成随机 ID；
+// 请求 ID 存入请求的 context（通过 `util.RequestID` 获取），写入响应头，并记录到 `Trace` 及访问日志中。
+package server
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"gosurf/util"
+	"net/http"
+)
+
+const RequestIDHeader = "X-Request-ID"
+
+// 沿用的请求 ID 长度上限，超出或包含不可见字符时重新生成
+const maxRequestIDLen = 128
+
+// `RequestID` 为请求 ID 中间件，可通过 `Proxy.Use(RequestID)` 使用。
+func RequestID(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		id := r.Header.Get(RequestIDHeader)
+		if !validRequestID(id) {
+			id = newRequestID()
+		}
+
+		w.Header().Set(RequestIDHeader, id)
+		if t := TraceFromContext(r.Context()); t != nil {
+			t.RequestID = id
+		}
+		next.ServeHTTP(w, r.WithContext(util.WithRequestID(r.Context(), id)))
+	})
+}
+
+func validRequestID(id string) bool {
+	if id == "" || len(id) > maxRequestIDLen {
+		return false
+	}
+	for i := 0; i < len(id); i++ {
+		if id[i] < 0x21 || id[i] > 0x7e {
+			return false
+		}
+	}
+	return true
+}
+
+func newRequestID() string {
+	var b [16]byte
+	rand.Read(b[:])
+	return hex.EncodeToString(b[:])
+}
@@ -0,0 +1,56 @@
+package server
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"gosurf/util"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestRequestID(t *testing.T) {
+	C := make(chan *Trace, 4)
+	p := NewProxy(context.Background(), ":0", C)
+	var buf bytes.Buffer
+	al := NewAccessLog(&buf, AccessLogConfig{Format: `%L %U`})
+	p.Use(al.Middleware, RequestID)
+	p.Handle(`/json/`, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		util.Json{"code": 0}.ResponseTo(r.Context(), w)
+	}))
+
+	r := httptest.NewRequest("GET", "/json/", nil)
+	r.Header.Set(RequestIDHeader, "req-42")
+	w := httptest.NewRecorder()
+	p.ServeHTTP(w, r)
+
+	if id := w.Header().Get(RequestIDHeader); id != "req-42" {
+		t.Errorf("expect echoed request id, got %q", id)
+	}
+	var body map[string]interface{}
+	if err := json.Unmarshal(w.Body.Bytes(), &body); err != nil || body["request_id"] != "req-42" {
+		t.Errorf("unexpected body %q", w.Body.String())
+	}
+
+	r = httptest.NewRequest("GET", "/json/", nil)
+	r.Header.Set(RequestIDHeader, strings.Repeat("x", maxRequestIDLen+1))
+	w = httptest.NewRecorder()
+	p.ServeHTTP(w, r)
+	generated := w.Header().Get(RequestIDHeader)
+	if len(generated) != 32 {
+		t.Errorf("expect generated request id, got %q", generated)
+	}
+
+	p.Stop()
+	if tr := <-C; tr.RequestID != "req-42" {
+		t.Errorf("expect trace request id req-42, got %q", tr.RequestID)
+	}
+	if tr := <-C; tr.RequestID != generated {
+		t.Errorf("expect trace request id %q, got %q", generated, tr.RequestID)
+	}
+	if log := buf.String(); log != "req-42 /json/\n"+generated+" /json/\n" {
+		t.Errorf("unexpected access log %q", log)
+	}
+}
@@ -0,0 +1,133 @@
+//go:build !windows
+
+// `restart.go` 实现了不中断服务的平滑重启：启动新的程序并将监听套接字作为继承的文件描述符传给它，
+// 待新进程开始处理请求后，当前进程停止接受新连接，等待处理中的请求完成后退出。
+package server
+
+import (
+	"errors"
+	"log"
+	"net"
+	"os"
+	"os/exec"
+	"os/signal"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
+)
+
+const readyTimeout = time.Minute
+
+// `Restart` 启动新进程接管监听，新进程就绪后优雅关闭当前服务器，此时 `Wait` 返回 `nil`。
+// 新进程启动失败或未能在期限内就绪时返回错误，当前服务器继续运行。
+func (p *Proxy) Restart() error {
+	p.rw.RLock()
+	lns := append([]net.Listener(nil), p.handoff...)
+	args := p.restartArgs
+	p.rw.RUnlock()
+	if len(args) == 0 {
+		args = os.Args
+	}
+
+	files := make([]*os.File, 0, len(lns)+1)
+	closeFiles := func() {
+		for _, f := range files {
+			f.Close()
+		}
+		files = nil
+	}
+	defer closeFiles()
+
+	for _, ln := range lns {
+		fl, ok := ln.(interface{ File() (*os.File, error) })
+		if !ok {
+			return errors.New("server: listener " + ln.Addr().String() + " can not be passed to child process")
+		}
+		f, err := fl.File()
+		if err != nil {
+			return err
+		}
+		files = append(files, f)
+	}
+
+	r, w, err := os.Pipe()
+	if err != nil {
+		return err
+	}
+	defer r.Close()
+	files = append(files, w)
+
+	var env []string
+	for _, kv := range os.Environ() {
+		if !strings.HasPrefix(kv, inheritFdsEnv+"=") && !strings.HasPrefix(kv, readyFdEnv+"=") {
+			env = append(env, kv)
+		}
+	}
+
+	cmd := exec.Command(args[0], args[1:]...)
+	cmd.Stdin, cmd.Stdout, cmd.Stderr = os.Stdin, os.Stdout, os.Stderr
+	cmd.Env = append(env,
+		inheritFdsEnv+"="+strconv.Itoa(len(lns)),
+		readyFdEnv+"="+strconv.Itoa(3+len(lns)),
+	)
+	cmd.ExtraFiles = files
+	if err := cmd.Start(); err != nil {
+		return err
+	}
+	closeFiles()
+
+	// 等待子进程就绪，子进程异常退出时管道关闭，读取返回错误
+	r.SetReadDeadline(time.Now().Add(readyTimeout))
+	if _, err := r.Read(make([]byte, 1)); err != nil {
+		cmd.Process.Kill()
+		cmd.Wait()
+		return errors.New("server: child process is not ready: " + err.Error())
+	}
+	cmd.Process.Release()
+
+	// 子进程仍在使用套接字文件，关闭时不能删除
+	for _, ln := range lns {
+		if ul, ok := ln.(*net.UnixListener); ok {
+			ul.SetUnlinkOnClose(false)
+		}
+	}
+
+	p.Stop()
+	return nil
+}
+
+// `HandleRestart` 在收到指定信号时平滑重启，未指定信号时监听 SIGUSR2。
+func (p *Proxy) HandleRestart(sig ...os.Signal) {
+	if len(sig) == 0 {
+		sig = []os.Signal{syscall.SIGUSR2}
+	}
+	c := make(chan os.Signal, 1)
+	signal.Notify(c, sig...)
+	go func() {
+		defer signal.Stop(c)
+		for {
+			select {
+			case <-c:
+				err := p.Restart()
+				if err == nil {
+					return
+				}
+				p.logf("server: restart failed: %v", err)
+			case <-p.done:
+				return
+			}
+		}
+	}()
+}
+
+func (p *Proxy) logf(format string, args ...interface{}) {
+	p.rw.RLock()
+	l := p.opts.errorLog
+	p.rw.RUnlock()
+	if l != nil {
+		l.Printf(format, args...)
+	} else {
+		log.Printf(format, args...)
+	}
+}
@@ -0,0 +1,128 @@
+//go:build !windows
+
+package server
+
+import (
+	"context"
+	"io"
+	"net"
+	"net/http"
+	"os"
+	"strconv"
+	"syscall"
+	"testing"
+	"time"
+)
+
+// `TestRestartChild` 为平滑重启测试中启动的子进程，单独运行时跳过。
+func TestRestartChild(t *testing.T) {
+	if os.Getenv(inheritFdsEnv) == "" {
+		t.Skip("only run as child process of TestRestart")
+	}
+
+	p := NewProxy(context.Background(), "127.0.0.1:0", nil)
+	p.Handle(`/`, nameHandler("child"))
+	p.Handle(`/quit/`, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		go p.Stop()
+	}))
+	if err := p.Run(); err != nil {
+		t.Fatal(err)
+	}
+	p.Wait()
+}
+
+func TestRestart(t *testing.T) {
+	p := NewProxy(context.Background(), "127.0.0.1:0", nil,
+		WithRestartCommand(os.Args[0], "-test.run=^TestRestartChild$"),
+		WithDrainTimeout(5*time.Second),
+	)
+	started := make(chan struct{})
+	p.Handle(`/`, nameHandler("parent"))
+	p.Handle(`/slow/`, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		close(started)
+		time.Sleep(200 * time.Millisecond)
+		w.Write([]byte("slow"))
+	}))
+	if err := p.Run(); err != nil {
+		t.Fatal(err)
+	}
+	url := "http://" + p.Addrs()[0].String()
+
+	get := func(path string) string {
+		client := &http.Client{Transport: &http.Transport{DisableKeepAlives: true}}
+		resp, err := client.Get(url + path)
+		if err != nil {
+			return err.Error()
+		}
+		defer resp.Body.Close()
+		b, _ := io.ReadAll(resp.Body)
+		return string(b)
+	}
+
+	if body := get("/"); body != "parent" {
+		t.Fatalf("expect parent, got %q", body)
+	}
+
+	slow := make(chan string, 1)
+	go func() { slow <- get("/slow/") }()
+	<-started
+
+	if err := p.Restart(); err != nil {
+		t.Fatal(err)
+	}
+	defer get("/quit/")
+
+	if body := <-slow; body != "slow" {
+		t.Errorf("in-flight request should complete, got %q", body)
+	}
+	if err := p.Wait(); err != nil {
+		t.Error(err)
+	}
+	if body := get("/"); body != "child" {
+		t.Errorf("expect child, got %q", body)
+	}
+}
+
+func TestListenFDs(t *testing.T) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ln.Close()
+	f, err := ln.(*net.TCPListener).File()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	// 复制的文件描述符由 `ListenFDs` 关闭
+	fd, err := syscall.Dup(int(f.Fd()))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	old := listenFdsStart
+	listenFdsStart = fd
+	t.Cleanup(func() { listenFdsStart = old })
+	t.Setenv("LISTEN_PID", strconv.Itoa(os.Getpid()))
+	t.Setenv("LISTEN_FDS", "1")
+	t.Setenv("LISTEN_FDNAMES", "web")
+
+	lns, err := ListenFDs()
+	if err != nil || len(lns) != 1 {
+		t.Fatalf("expect 1 listener, got %v %v", lns, err)
+	}
+	defer lns[0].Close()
+	if lns[0].Addr().String() != ln.Addr().String() {
+		t.Errorf("expect %s, got %s", ln.Addr(), lns[0].Addr())
+	}
+
+	// 环境变量已清除，再次调用不会重复使用文件描述符
+	for _, key := range []string{"LISTEN_PID", "LISTEN_FDS", "LISTEN_FDNAMES"} {
+		if _, ok := os.LookupEnv(key); ok {
+			t.Errorf("expect %s unset", key)
+		}
+	}
+	if lns, err := ListenFDs(); lns != nil || err != nil {
+		t.Errorf("expect nothing on second call, got %v %v", lns, err)
+	}
+}
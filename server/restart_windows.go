@@ -0,0 +1,13 @@
+package server
+
+import (
+	"errors"
+	"os"
+)
+
+// `Restart` 在 Windows 上不支持平滑重启。
+func (p *Proxy) Restart() error {
+	return errors.New("server: graceful restart is not supported on windows")
+}
+
+func (p *Proxy) HandleRestart(sig ...os.Signal) {}
@@ -0,0 +1,134 @@
+// `reverse.go` 实现了根据路由名称反向构建 URL。
+// 路由名称取自注册时 `View` 的 `Name` 字段，参数通过正则中的命名分组填充。
+package server
+
+import (
+	"errors"
+	"fmt"
+	"net/url"
+	"regexp"
+	"regexp/syntax"
+	"strings"
+)
+
+// `Reverse` 根据路由名称及 `key, value` 形式的参数构建路径，参数通过 `fmt.Sprint` 格式化，值经 `url.PathEscape` 转义，
+// 参数缺失、多余或与命名分组不匹配，以及构建的路径与路由不匹配时返回错误。
+//
+//	p.Reverse("user_detail", "id", 42) // "/user/42/"
+func (p *Proxy) Reverse(name string, params ...interface{}) (string, error) {
+	if len(params)%2 != 0 {
+		return "", errors.New("server: reverse " + name + ": odd number of params")
+	}
+
+	// 重复注册路由时 `router.add` 会修改路由，因此持锁复制一份
+	p.rw.RLock()
+	found, ok := p.router.names[name]
+	var rt route
+	if ok {
+		rt = *found
+	}
+	p.rw.RUnlock()
+	if !ok {
+		return "", errors.New("server: reverse " + name + ": no route named " + name)
+	}
+
+	vals := make(map[string]string, len(params)/2)
+	for i := 0; i < len(params); i += 2 {
+		vals[fmt.Sprint(params[i])] = fmt.Sprint(params[i+1])
+	}
+
+	raw := strings.TrimSuffix(strings.TrimPrefix(rt.raw, "^"), "$")
+	re, err := syntax.Parse(raw, syntax.Perl)
+	if err != nil {
+		return "", errors.New("server: reverse " + name + ": " + err.Error())
+	}
+
+	used := make(map[string]bool, len(vals))
+	var buf strings.Builder
+	if err := build(&buf, re.Simplify(), vals, used); err != nil {
+		return "", errors.New("server: reverse " + name + ": " + err.Error())
+	}
+
+	for key := range vals {
+		if !used[key] {
+			return "", errors.New("server: reverse " + name + ": unknown param " + key)
+		}
+	}
+
+	// 路由匹配解码后的 `URL.Path`
+	u := buf.String()
+	path, err := url.PathUnescape(u)
+	if err != nil {
+		return "", errors.New("server: reverse " + name + ": " + err.Error())
+	}
+	if m := rt.re.FindStringSubmatch(path); m == nil || !rt.accept(m) {
+		return "", errors.New("server: reverse " + name + ": " + u + " does not match pattern " + rt.pattern)
+	}
+	return u, nil
+}
+
+// `build` 将正则语法树还原为具体字符串，可选部分仅在其包含已提供的参数时输出。
+func build(buf *strings.Builder, re *syntax.Regexp, vals map[string]string, used map[string]bool) error {
+	switch re.Op {
+	case syntax.OpLiteral:
+		buf.WriteString(string(re.Rune))
+	case syntax.OpConcat:
+		for _, sub := range re.Sub {
+			if err := build(buf, sub, vals, used); err != nil {
+				return err
+			}
+		}
+	case syntax.OpCapture:
+		if re.Name == "" {
+			return build(buf, re.Sub[0], vals, used)
+		}
+		val, ok := vals[re.Name]
+		if !ok {
+			return errors.New("missing param " + re.Name)
+		}
+		if !regexp.MustCompile(`^(?:` + re.Sub[0].String() + `)$`).MatchString(val) {
+			return errors.New("param " + re.Name + " " + val + " does not match " + re.Sub[0].String())
+		}
+		used[re.Name] = true
+		buf.WriteString(url.PathEscape(val))
+	case syntax.OpQuest, syntax.OpStar:
+		if provided(re.Sub[0], vals) {
+			return build(buf, re.Sub[0], vals, used)
+		}
+	case syntax.OpPlus:
+		return build(buf, re.Sub[0], vals, used)
+	case syntax.OpAlternate:
+		for _, sub := range re.Sub {
+			var b strings.Builder
+			u := make(map[string]bool)
+			if build(&b, sub, vals, u) == nil {
+				buf.WriteString(b.String())
+				for k := range u {
+					used[k] = true
+				}
+				return nil
+			}
+		}
+		return errors.New("no alternative of " + re.String() + " can be built")
+	case syntax.OpEmptyMatch, syntax.OpBeginLine, syntax.OpEndLine, syntax.OpBeginText,
+		syntax.OpEndText, syntax.OpWordBoundary, syntax.OpNoWordBoundary:
+	default:
+		return errors.New("can not reverse " + re.String() + " outside of a named group")
+	}
+	return nil
+}
+
+// `provided` 判断语法树中是否存在已提供值的命名分组。
+func provided(re *syntax.Regexp, vals map[string]string) bool {
+	if re.Op == syntax.OpCapture && re.Name != "" {
+		if _, ok := vals[re.Name]; ok {
+			return true
+		}
+	}
+	for _, sub := range re.Sub {
+		if provided(sub, vals) {
+			return true
+		}
+	}
+	return false
+}
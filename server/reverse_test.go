@@ -0,0 +1,92 @@
+package server
+
+import (
+	"bytes"
+	"context"
+	"gosurf/template"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestReverse(t *testing.T) {
+	p := NewProxy(context.Background(), ":0", nil)
+	p.Handle(`/api/logout/`, View{Name: "logout_api"})
+	p.Handle(`/user/(?P<id>\d+)/`, View{Name: "user_detail"})
+	p.Handle(`/list(?:/page/(?P<page>\d+))?/`, View{Name: "list"})
+	p.Handle(`/debug/pprof/.*`, View{Name: "pprof"})
+	p.Handle(`/tag/(?P<tag>[^/]+)/`, View{Name: "tag"})
+	p.Handle(`/files/(?P<path>.+)`, View{Name: "file"})
+
+	cases := []struct {
+		name   string
+		params []interface{}
+		expect string
+	}{
+		{"logout_api", nil, "/api/logout/"},
+		{"user_detail", []interface{}{"id", "42"}, "/user/42/"},
+		{"user_detail", []interface{}{"id", 42}, "/user/42/"},
+		{"list", nil, "/list/"},
+		{"list", []interface{}{"page", int64(3)}, "/list/page/3/"},
+		// 值经过转义，不会改变路径结构
+		{"tag", []interface{}{"tag", "a b?c#d"}, "/tag/a%20b%3Fc%23d/"},
+		{"file", []interface{}{"path", "a/b c"}, "/files/a%2Fb%20c"},
+		{"pprof", nil, "/debug/pprof/"},
+	}
+	for _, c := range cases {
+		url, err := p.Reverse(c.name, c.params...)
+		if err != nil || url != c.expect {
+			t.Errorf("%s %v: expect %q, got %q (%v)", c.name, c.params, c.expect, url, err)
+		}
+	}
+}
+
+func TestReverseError(t *testing.T) {
+	p := NewProxy(context.Background(), ":0", nil)
+	p.Handle(`/user/(?P<id>\d+)/`, View{Name: "user_detail"})
+	p.Handle(`/u/{id:int}/`, View{Name: "u"})
+	if url, err := p.Reverse("u", "id", 5); err != nil || url != "/u/5/" {
+		t.Errorf("expect /u/5/, got %q (%v)", url, err)
+	}
+
+	cases := [][]interface{}{
+		{"unknown"},
+		{"user_detail"},
+		{"user_detail", "id", "abc"},
+		{"user_detail", "id", -1},
+		// 超出转换器范围的值无法匹配路由
+		{"u", "id", "99999999999999999999"},
+		{"user_detail", "id", "42", "extra", "1"},
+		{"user_detail", "id"},
+	}
+	for _, c := range cases {
+		if url, err := p.Reverse(c[0].(string), c[1:]...); err == nil {
+			t.Errorf("%v: expect error, got %q", c, url)
+		}
+	}
+}
+
+func TestReverseTemplate(t *testing.T) {
+	p := NewProxy(context.Background(), ":0", nil)
+	p.Handle(`/user/(?P<id>\d+)/`, View{Name: "user_detail"})
+
+	dir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(dir, "reverse.html"), []byte(`{{ url "user_detail" "id" .ID }}`), 0644); err != nil {
+		t.Fatal(err)
+	}
+	old := template.TmplDir()
+	t.Cleanup(func() {
+		template.SetTmplDir(old)
+		template.RegisterFunc("url", Reverse)
+	})
+	template.SetTmplDir(dir)
+	template.RegisterFunc("url", p.Reverse)
+
+	var out bytes.Buffer
+	if err := template.Render(&out, "reverse.html", map[string]interface{}{"ID": 42}); err != nil {
+		t.Fatal(err)
+	}
+	if out.String() != "/user/42/" {
+		t.Errorf("unexpected template output %q", out.String())
+	}
+}
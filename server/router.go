@@ -0,0 +1,248 @@
+// `router.go` 实现了预编译的路由表。
+// 路由在 `Handle` 时编译正则表达式，并按正则中的静态前缀插入前缀树（radix tree），
+// 匹配时只需沿请求路径遍历前缀树，仅对前缀相符的路由执行正则匹配，
+// 因此路由表增长后匹配开销基本保持不变。
+// 多个路由同时匹配时，优先级高者胜出，优先级相同则按注册顺序先注册者胜出。
+package server
+
+import (
+	"net/http"
+	"regexp"
+	"regexp/syntax"
+	"sort"
+	"strings"
+)
+
+type route struct {
+	key      string
+	pattern  string
+	raw      string
+	name     string
+	re       *regexp.Regexp
+	names    []string
+	checks   map[string]func(s string) bool
+	handler  http.Handler
+	mws      []Middleware
+	group    *Group
+	chain    http.Handler
+	stats    *routeStats
+	priority int
+	seq      int
+}
+
+// `before` 判断路由 `rt` 的匹配顺序是否先于 `o`。
+func (rt *route) before(o *route) bool {
+	if rt.priority != o.priority {
+		return rt.priority > o.priority
+	}
+	return rt.seq < o.seq
+}
+
+// `accept` 使用转换器的校验方法检查匹配到的参数。
+func (rt *route) accept(match []string) bool {
+	for i, name := range rt.names {
+		if check, ok := rt.checks[name]; ok && !check(match[i]) {
+			return false
+		}
+	}
+	return true
+}
+
+func (rt *route) params(match []string) *Params {
+	p := &Params{
+		m: make(map[string]string, len(match)),
+		s: match,
+	}
+	for i, name := range rt.names {
+		p.m[name] = match[i]
+	}
+	return p
+}
+
+type node struct {
+	prefix   string
+	children []*node
+	routes   []*route
+}
+
+func (n *node) child(c byte) *node {
+	for _, ch := range n.children {
+		if ch.prefix[0] == c {
+			return ch
+		}
+	}
+	return nil
+}
+
+func (n *node) insert(key string, rt *route) {
+	for key != "" {
+		ch := n.child(key[0])
+		if ch == nil {
+			ch = &node{prefix: key}
+			n.children = append(n.children, ch)
+			n = ch
+			break
+		}
+
+		l := commonPrefix(key, ch.prefix)
+		if l < len(ch.prefix) {
+			// 拆分节点，公共部分保留在原节点上
+			split := &node{prefix: ch.prefix[l:], children: ch.children, routes: ch.routes}
+			ch.prefix = ch.prefix[:l]
+			ch.children = []*node{split}
+			ch.routes = nil
+		}
+
+		key = key[l:]
+		n = ch
+	}
+
+	n.routes = append(n.routes, rt)
+	sort.SliceStable(n.routes, func(i, j int) bool { return n.routes[i].before(n.routes[j]) })
+}
+
+// `lookup` 沿前缀树查找匹配 `target` 的路由，`best` 为当前已找到的最优路由。
+func (n *node) lookup(target string, best *route, match []string) (*route, []string) {
+	s := target
+	for n != nil {
+		for _, rt := range n.routes {
+			if best != nil && !rt.before(best) {
+				break
+			}
+			if m := rt.re.FindStringSubmatch(target); m != nil && rt.accept(m) {
+				best, match = rt, m
+				break
+			}
+		}
+
+		if s == "" {
+			break
+		}
+		n = n.child(s[0])
+		if n == nil || !strings.HasPrefix(s, n.prefix) {
+			break
+		}
+		s = s[len(n.prefix):]
+	}
+	return best, match
+}
+
+func commonPrefix(a, b string) int {
+	i := 0
+	for i < len(a) && i < len(b) && a[i] == b[i] {
+		i++
+	}
+	return i
+}
+
+// `literalPrefix` 返回锚定正则表达式开头的静态字符串，
+// 未以 `^` 锚定或以非字面量开头的正则返回空字符串。
+func literalPrefix(pattern string) string {
+	re, err := syntax.Parse(pattern, syntax.Perl)
+	if err != nil {
+		return ""
+	}
+	re = re.Simplify()
+
+	subs := []*syntax.Regexp{re}
+	if re.Op == syntax.OpConcat {
+		subs = re.Sub
+	}
+	if len(subs) == 0 || subs[0].Op != syntax.OpBeginText {
+		return ""
+	}
+
+	var buf strings.Builder
+	for _, sub := range subs[1:] {
+		if sub.Op != syntax.OpLiteral || sub.Flags&syntax.FoldCase != 0 {
+			break
+		}
+		buf.WriteString(string(sub.Rune))
+	}
+	return buf.String()
+}
+
+// `router` 分别维护匹配 `URL.Path` 的路由与匹配 `Host + URL.Path` 的路由。
+type router struct {
+	seq    int
+	routes map[string]*route
+	names  map[string]*route
+	path   *node
+	host   *node
+}
+
+func newRouter() *router {
+	return &router{
+		routes: make(map[string]*route),
+		names:  make(map[string]*route),
+		path:   new(node),
+		host:   new(node),
+	}
+}
+
+// `add` 编译并注册路由，正则表达式不合法时 panic。
+// 重复注册同一个路由（以展开转换器前的 `pattern` 区分）时替换原有的处理方法、名称及优先级，但保留注册顺序。
+// 同名路由以最后注册的为准。
+func (t *router) add(rt *route) *route {
+	if old, ok := t.routes[rt.key]; ok {
+		if old.name != "" && t.names[old.name] == old {
+			delete(t.names, old.name)
+		}
+		old.raw, old.name, old.checks = rt.raw, rt.name, rt.checks
+		old.handler, old.mws, old.group = rt.handler, rt.mws, rt.group
+		if old.name != "" {
+			t.names[old.name] = old
+		}
+		if old.priority != rt.priority {
+			old.priority = rt.priority
+			t.rebuild()
+		}
+		return old
+	}
+
+	rt.re = regexp.MustCompile(rt.pattern)
+	rt.names = rt.re.SubexpNames()
+	rt.stats = newRouteStats()
+	t.seq++
+	rt.seq = t.seq
+	t.routes[rt.key] = rt
+	if rt.name != "" {
+		t.names[rt.name] = rt
+	}
+	t.insert(rt)
+	return rt
+}
+
+// `insert` 将路由插入前缀树，静态前缀不以 `/` 开头的路由（如 `example.com/`）匹配 `Host + URL.Path`，
+// 其余路由（包括以 `(?i)`、分组或分支开头的路由）匹配 `URL.Path`。
+func (t *router) insert(rt *route) {
+	prefix := literalPrefix(rt.pattern)
+	if prefix != "" && prefix[0] != '/' {
+		t.host.insert(prefix, rt)
+	} else {
+		t.path.insert(prefix, rt)
+	}
+}
+
+func (t *router) rebuild() {
+	t.path, t.host = new(node), new(node)
+	for _, rt := range t.routes {
+		t.insert(rt)
+	}
+}
+
+// `match` 返回匹配请求的路由及参数，未匹配时返回 `nil`。
+func (t *router) match(r *http.Request) (*route, *Params) {
+	best, match := t.path.lookup(r.URL.Path, nil, nil)
+	if len(t.host.children) > 0 || len(t.host.routes) > 0 {
+		host := r.URL.Host
+		if host == "" {
+			host = r.Host
+		}
+		best, match = t.host.lookup(host+r.URL.Path, best, match)
+	}
+	if best == nil {
+		return nil, nil
+	}
+	return best, best.params(match)
+}
@@ -0,0 +1,191 @@
+package server
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"regexp"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+func nameHandler(name string) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(name))
+	})
+}
+
+func serve(h http.Handler, method, target string) *httptest.ResponseRecorder {
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, httptest.NewRequest(method, target, nil))
+	return w
+}
+
+func TestRouterRegistrationOrder(t *testing.T) {
+	p := NewProxy(context.Background(), ":0", nil)
+	p.Handle(`/api/.*`, nameHandler("wildcard"))
+	p.Handle(`/api/user/`, nameHandler("user"))
+
+	// 重复多次以确保匹配结果不再随机
+	for i := 0; i < 100; i++ {
+		if body := serve(p, "GET", "/api/user/").Body.String(); body != "wildcard" {
+			t.Fatalf("expect wildcard, got %q", body)
+		}
+	}
+}
+
+func TestRouterPriority(t *testing.T) {
+	p := NewProxy(context.Background(), ":0", nil)
+	p.Handle(`/api/.*`, nameHandler("wildcard"))
+	p.HandlePriority(`/api/user/`, 10, nameHandler("user"))
+
+	if body := serve(p, "GET", "/api/user").Body.String(); body != "user" {
+		t.Errorf("expect user, got %q", body)
+	}
+	if body := serve(p, "GET", "/api/other").Body.String(); body != "wildcard" {
+		t.Errorf("expect wildcard, got %q", body)
+	}
+}
+
+func TestRouterReplace(t *testing.T) {
+	p := NewProxy(context.Background(), ":0", nil)
+	p.Handle(`/a/`, nameHandler("first"))
+	p.Handle(`/a/`, nameHandler("second"))
+
+	if body := serve(p, "GET", "/a/").Body.String(); body != "second" {
+		t.Errorf("expect second, got %q", body)
+	}
+}
+
+func TestRouterParams(t *testing.T) {
+	p := NewProxy(context.Background(), ":0", nil)
+	p.Handle(`/user/(?P<id>\d+)/(\w+)/`, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		pm := r.Context().Value(CtxParamKey).(*Params)
+		w.Write([]byte(pm.Get("id") + "," + pm.GetByIndex(2)))
+	}))
+
+	if body := serve(p, "GET", "/user/42/edit/").Body.String(); body != "42,edit" {
+		t.Errorf("expect 42,edit, got %q", body)
+	}
+	if code := serve(p, "GET", "/user/abc/edit/").Code; code != http.StatusNotFound {
+		t.Errorf("expect 404, got %d", code)
+	}
+}
+
+func TestRouterHost(t *testing.T) {
+	p := NewProxy(context.Background(), ":0", nil)
+	p.Handle(`/`, nameHandler("path"))
+	p.Handle(`example.com/`, nameHandler("host"))
+
+	r := httptest.NewRequest("GET", "/", nil)
+	r.Host = "example.com"
+	w := httptest.NewRecorder()
+	p.ServeHTTP(w, r)
+	if body := w.Body.String(); body != "path" {
+		t.Errorf("expect path, got %q", body)
+	}
+
+	r = httptest.NewRequest("GET", "/", nil)
+	r.Host = "example.com"
+	w = httptest.NewRecorder()
+	p.HandlePriority(`example.com/`, 1, nameHandler("host"))
+	p.ServeHTTP(w, r)
+	if body := w.Body.String(); body != "host" {
+		t.Errorf("expect host, got %q", body)
+	}
+}
+
+func TestRouterPathPatterns(t *testing.T) {
+	p := NewProxy(context.Background(), ":0", nil)
+	p.Handle(`(?i)/api/`, nameHandler("api"))
+	p.Handle(`(/foo|/bar)/`, nameHandler("foobar"))
+
+	// 以标志或分组开头的路由仍然只匹配路径
+	for target, body := range map[string]string{"/API/": "api", "/api/": "api", "/foo/": "foobar", "/bar/": "foobar"} {
+		if w := serve(p, "GET", target); w.Code != http.StatusOK || w.Body.String() != body {
+			t.Errorf("%s: expect %s, got %d %q", target, body, w.Code, w.Body.String())
+		}
+	}
+}
+
+func TestLiteralPrefix(t *testing.T) {
+	cases := map[string]string{
+		`^/api/logout/?$`:         "/api/logout",
+		`^/debug/pprof/.*/?$`:     "/debug/pprof/",
+		`^/user/(?P<id>\d+)/?$`:   "/user/",
+		`^(?i)/api/?$`:            "",
+		`/api/`:                   "",
+		`^example\.com/static/?$`: "example.com/static",
+	}
+	for pattern, expect := range cases {
+		if prefix := literalPrefix(pattern); prefix != expect {
+			t.Errorf("%s: expect %q, got %q", pattern, expect, prefix)
+		}
+	}
+}
+
+// `legacyRouter` 为旧版遍历 `map` 并在每次请求时编译正则的实现，仅用于基准测试对比。
+type legacyRouter map[string]http.Handler
+
+func (lr legacyRouter) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	for pattern, handler := range lr {
+		re := regexp.MustCompile(pattern)
+		url := r.URL.Path
+		if !strings.HasPrefix(pattern, "^/") {
+			url = r.URL.Host + r.URL.Path
+		}
+		if !re.MatchString(url) {
+			continue
+		}
+		subName := re.SubexpNames()
+		subMatch := re.FindStringSubmatch(url)
+		pm := &Params{m: make(map[string]string), s: make([]string, len(subName))}
+		for i := 0; i < len(subName); i++ {
+			pm.m[subName[i]] = subMatch[i]
+			pm.s[i] = subMatch[i]
+		}
+		handler.ServeHTTP(w, r.WithContext(context.WithValue(r.Context(), CtxParamKey, pm)))
+		return
+	}
+	http.NotFound(w, r)
+}
+
+var benchSizes = []int{10, 100, 500}
+
+func benchRoutes(n int, handle func(pattern string)) string {
+	for i := 0; i < n; i++ {
+		handle(`/api/resource` + strconv.Itoa(i) + `/(?P<id>\d+)/`)
+	}
+	return "/api/resource" + strconv.Itoa(n-1) + "/42/"
+}
+
+func BenchmarkRouter(b *testing.B) {
+	for _, n := range benchSizes {
+		b.Run(strconv.Itoa(n), func(b *testing.B) {
+			p := NewProxy(context.Background(), ":0", nil)
+			target := benchRoutes(n, func(pattern string) { p.Handle(pattern, http.NotFoundHandler()) })
+			r := httptest.NewRequest("GET", target, nil)
+			w := httptest.NewRecorder()
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+				p.ServeHTTP(w, r)
+			}
+		})
+	}
+}
+
+func BenchmarkLegacyRouter(b *testing.B) {
+	for _, n := range benchSizes {
+		b.Run(strconv.Itoa(n), func(b *testing.B) {
+			lr := make(legacyRouter)
+			target := benchRoutes(n, func(pattern string) { lr[regex(pattern)] = http.NotFoundHandler() })
+			r := httptest.NewRequest("GET", target, nil)
+			w := httptest.NewRecorder()
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+				lr.ServeHTTP(w, r)
+			}
+		})
+	}
+}
@@ -2,133 +2,188 @@
 package server
 
 import (
-	"bytes"
 	"context"
-	"io"
+	"gosurf/template"
+	"io/fs"
+	"net"
 	"net/http"
+	"os"
 	"runtime/debug"
 	"sync"
+	"sync/atomic"
 	"time"
 )
 
-func NewProxy(ctx context.Context, address string, C chan *Trace) *Proxy {
+func NewProxy(ctx context.Context, address string, C chan *Trace, opts ...Option) *Proxy {
 	p := &Proxy{
 		rw:      new(sync.RWMutex),
 		address: address,
-		router:  make(map[string]http.Handler),
+		router:  newRouter(),
+		opts:    defaultServerOptions(),
 	}
 	p.ctx, p.cancel = context.WithCancel(ctx)
+	p.done = make(chan struct{})
+	p.errc = make(chan error, 1)
 	if C != nil {
-		p.channel = C
+		p.sink = NewChanSink(p.ctx, C)
 		p.tracing = true
 	}
+	p.func403 = func(w http.ResponseWriter, r *http.Request) { http.Error(w, "403 forbidden", 403) }
 	p.func404 = http.NotFound
 	p.func405 = func(w http.ResponseWriter, r *http.Request) { http.Error(w, "405 method not allowed", 405) }
+	p.func429 = func(w http.ResponseWriter, r *http.Request) { http.Error(w, "429 too many requests", 429) }
 	p.func500 = func(w http.ResponseWriter, r *http.Request) { http.Error(w, "500 internal error", 500) }
-	p.shutdown = func() {}
+	p.metrics.notFound = newRouteStats()
+	p.queue = newTraceQueue(defaultTraceQueueSize, DropNewest, p.deliver)
+	p.drainTimeout = defaultDrainTimeout
+	p.notFound = http.HandlerFunc(p.serve404)
+	for _, opt := range opts {
+		opt(p)
+	}
 	return p
 }
 
 type Proxy struct {
-	rw       *sync.RWMutex
-	ctx      context.Context
-	cancel   func()
-	address  string
-	router   map[string]http.Handler
-	channel  chan *Trace
-	tracing  bool
-	shutdown func()
+	rw      *sync.RWMutex
+	ctx     context.Context
+	cancel  func()
+	address string
+	router  *router
+
+	// request tracing
+	sink    TraceSink
+	sampler func(t *Trace) bool
+	queue   *traceQueue
+	tracing bool
+
+	// server lifecycle
+	opts         serverOptions
+	srv          *http.Server
+	servers      []*http.Server
+	listeners    []net.Listener
+	handoff      []net.Listener
+	restartArgs  []string
+	socketMode   os.FileMode
+	tlsPort      string
+	hooks        []func()
+	drainTimeout time.Duration
+	closed       bool
+	done         chan struct{}
+	errc         chan error
+	err          error
+
+	metrics metrics
+	debug   bool
+
+	// middleware chain
+	mws      []Middleware
+	notFound http.Handler
 
 	// status method func
-	func404, func405, func500 func(w http.ResponseWriter, r *http.Request)
+	func403, func404, func405, func429, func500 func(w http.ResponseWriter, r *http.Request)
 }
 
-func (p *Proxy) Run() {
-	p.rw.Lock()
-	defer p.rw.Unlock()
-	// make server
-	srv := &http.Server{
-		Addr:         p.address,
-		Handler:      p,
-		ReadTimeout:  30 * time.Second,
-		WriteTimeout: 30 * time.Second,
-	}
-	go srv.ListenAndServe()
-	p.shutdown = func() { srv.Shutdown(context.Background()) }
+func (p *Proxy) Handle(pattern string, handler http.Handler) {
+	p.HandlePriority(pattern, 0, handler)
 }
 
-func (p *Proxy) Stop() {
-	p.rw.Lock()
-	defer p.rw.Unlock()
-	p.cancel()
-	if p.channel != nil {
-		p.tracing = false
-		close(p.channel)
-	}
-	p.shutdown()
+// `HandlePriority` 注册带优先级的路由，多个路由同时匹配时优先级高者胜出，
+// 优先级相同时按注册顺序匹配。
+func (p *Proxy) HandlePriority(pattern string, priority int, handler http.Handler) {
+	p.handle(&route{raw: pattern, handler: handler, priority: priority})
 }
 
-func (p *Proxy) Handle(pattern string, handler http.Handler) {
-	pattern = regex(pattern)
+func (p *Proxy) handle(rt *route) {
+	rt.key = regex(rt.raw)
+	rt.raw, rt.checks = expand(rt.raw)
+	rt.pattern = regex(rt.raw)
 
 	p.rw.Lock()
 	defer p.rw.Unlock()
 
 	// set 405 method not allowed func for View type
-	if view, ok := handler.(View); ok {
-		view.func405 = p.func405
+	switch view := rt.handler.(type) {
+	case View:
+		view.func405 = p.serve405
+		rt.handler = view
+		rt.name = view.Name
+	case *View:
+		view.func405 = p.serve405
+		rt.name = view.Name
 	}
 
-	p.router[pattern] = handler
+	p.compose(p.router.add(rt))
 }
 
-func (p *Proxy) send(t *Trace) {
-	select {
-	case <-p.ctx.Done():
-	case p.channel <- t:
-	}
-}
+func (p *Proxy) recoverHTTP(w http.ResponseWriter, r *http.Request) {
+	if err := recover(); err != nil {
+		atomic.AddUint64(&p.metrics.panics, 1)
 
-func (p *Proxy) sendTrace(path string, err interface{}, withStack bool) {
-	p.rw.RLock()
-	send := p.tracing && p.channel != nil
-	p.rw.RUnlock()
-	if send {
-		t := &Trace{Path: path, Err: err}
-		if withStack {
-			t.Stack = debug.Stack()
+		// record panic in trace
+		stack := debug.Stack()
+		if t := TraceFromContext(r.Context()); t != nil {
+			t.Err, t.Stack = err, stack
 		}
-		go p.send(t)
-	}
-}
 
-func (p *Proxy) recoverHTTP(w http.ResponseWriter, r *http.Request) {
-	if err := recover(); err != nil {
-		// send trace message
-		p.sendTrace(r.URL.Path, err, true)
+		p.rw.RLock()
+		debugging := p.debug
+		p.rw.RUnlock()
+		if debugging {
+			p.serveDebug(w, r, err, stack)
+			return
+		}
 
-		// call preset 500 function
-		p.func500(w, r)
+		p.serve500(w, r)
 	}
 }
 
 // `ServeHTTP` 是开启服务器的入口方法，将自动匹配 URL 并执行相应的响应方法。
 func (p *Proxy) ServeHTTP(w http.ResponseWriter, r *http.Request) {
-	defer p.recoverHTTP(w, r)
-
 	p.rw.RLock()
-	defer p.rw.RUnlock()
+	rt, pm := p.router.match(r)
+	h, stats := p.notFound, p.metrics.notFound
+	if rt != nil {
+		h, stats = rt.chain, rt.stats
+	}
+	tracing := p.tracing
+	p.rw.RUnlock()
 
-	for pattern, handler := range p.router {
-		if pm, ok := parseReq(r, pattern); ok {
-			ctx := context.WithValue(r.Context(), CtxParamKey, pm)
-			handler.ServeHTTP(w, r.WithContext(ctx))
-			return
+	start := time.Now()
+	ww := WrapResponseWriter(w)
+	atomic.AddInt64(&p.metrics.inFlight, 1)
+	defer p.observe(stats, ww, start)
+
+	ctx := r.Context()
+	if pm != nil {
+		ctx = context.WithValue(ctx, CtxParamKey, pm)
+	}
+
+	if tracing {
+		t := &Trace{
+			Time:       start,
+			Method:     r.Method,
+			Path:       r.URL.Path,
+			RemoteAddr: r.RemoteAddr,
+		}
+		if rt != nil {
+			t.Pattern, t.Name = rt.pattern, rt.name
 		}
+		ctx = context.WithValue(ctx, traceKey{}, t)
+		defer p.finishTrace(t, ww)
 	}
 
-	// call preset 404 function
-	p.func404(w, r)
+	r = r.WithContext(ctx)
+	defer p.recoverHTTP(ww, r)
+	h.ServeHTTP(ww, r)
+}
+
+func (p *Proxy) Set403(func403 func(w http.ResponseWriter, r *http.Request)) {
+	if func403 == nil {
+		panic("server: error nil 403 func")
+	}
+	p.rw.Lock()
+	defer p.rw.Unlock()
+	p.func403 = func403
 }
 
 func (p *Proxy) Set404(func404 func(w http.ResponseWriter, r *http.Request)) {
@@ -149,6 +204,15 @@ func (p *Proxy) Set405(func405 func(w http.ResponseWriter, r *http.Request)) {
 	p.func405 = func405
 }
 
+func (p *Proxy) Set429(func429 func(w http.ResponseWriter, r *http.Request)) {
+	if func429 == nil {
+		panic("server: error nil 429 func")
+	}
+	p.rw.Lock()
+	defer p.rw.Unlock()
+	p.func429 = func429
+}
+
 func (p *Proxy) Set500(func500 func(w http.ResponseWriter, r *http.Request)) {
 	if func500 == nil {
 		panic("server: error nil 500 func")
@@ -158,30 +222,48 @@ func (p *Proxy) Set500(func500 func(w http.ResponseWriter, r *http.Request)) {
 	p.func500 = func500
 }
 
-type Trace struct {
-	Path  string
-	Err   interface{}
-	Stack []byte
-}
-
-func (t *Trace) PrintStack(w io.Writer) (n int64, err error) {
-	if t.Stack == nil {
-		return
-	}
-	var buf bytes.Buffer
-	buf.WriteString("=== DEBUG - PRINT STACK - [" + time.Now().Format("2006-01-02 15:04:05") + "] ===\n")
-	buf.Write(t.Stack)
-	buf.WriteString("\n")
-	return buf.WriteTo(w)
-}
-
 // new web handler
 var defaultProxy = NewProxy(context.Background(), ":http", nil)
 
+// 为模板注册 `url` 方法，如 `{{ url "user_detail" "id" .ID }}`，
+// 使用自建 `Proxy` 时可通过 `template.RegisterFunc("url", p.Reverse)` 覆盖。
+// `csrf_token`、`csrf_field` 方法用于 `RenderWithRequest` 渲染的表单，如 `{{ csrf_field .request }}`。
+// `static` 方法返回静态文件带哈希的 URL，如 `{{ static "app.js" }}`，清单由 `Fingerprint` 或 `SetManifest` 设置。
+func init() {
+	template.RegisterFunc("url", Reverse)
+	template.RegisterFunc("static", StaticURL)
+	template.RegisterFunc("csrf_token", CSRFToken)
+	template.RegisterFunc("csrf_field", CSRFField)
+}
+
 func Handle(pattern string, handler http.Handler) {
 	defaultProxy.Handle(pattern, handler)
 }
 
+func HandlePriority(pattern string, priority int, handler http.Handler) {
+	defaultProxy.HandlePriority(pattern, priority, handler)
+}
+
+func Reverse(name string, params ...interface{}) (string, error) {
+	return defaultProxy.Reverse(name, params...)
+}
+
+func HandleWith(pattern string, handler http.Handler, mw ...Middleware) {
+	defaultProxy.HandleWith(pattern, handler, mw...)
+}
+
+func Use(mw ...Middleware) {
+	defaultProxy.Use(mw...)
+}
+
+func NewGroup(prefix string, mw ...Middleware) *Group {
+	return defaultProxy.Group(prefix, mw...)
+}
+
+func Configure(opts ...Option) {
+	defaultProxy.Configure(opts...)
+}
+
 func SetAddress(addr string) {
 	defaultProxy.rw.Lock()
 	defer defaultProxy.rw.Unlock()
@@ -192,10 +274,47 @@ func Watch(C chan *Trace) {
 	if C == nil {
 		panic("server: error nil channel")
 	}
-	defaultProxy.rw.Lock()
-	defer defaultProxy.rw.Unlock()
-	defaultProxy.channel = C
-	defaultProxy.tracing = true
+	defaultProxy.SetTraceSink(NewChanSink(defaultProxy.ctx, C))
+}
+
+func SetTraceSink(sink TraceSink) {
+	defaultProxy.SetTraceSink(sink)
+}
+
+func SetTraceSampler(fn func(t *Trace) bool) {
+	defaultProxy.SetTraceSampler(fn)
+}
+
+func ServeStatic(dir string, opts ...StaticOption) http.Handler {
+	return defaultProxy.ServeStatic(dir, opts...)
+}
+
+func ServeFS(fsys fs.FS, opts ...StaticOption) http.Handler {
+	return defaultProxy.ServeFS(fsys, opts...)
+}
+
+func MetricsHandler() http.Handler {
+	return defaultProxy.MetricsHandler()
+}
+
+func DroppedTraces() uint64 {
+	return defaultProxy.DroppedTraces()
+}
+
+func CSRF(cfg CSRFConfig) Middleware {
+	return defaultProxy.CSRF(cfg)
+}
+
+func RateLimit(cfg RateLimitConfig) Middleware {
+	return defaultProxy.RateLimit(cfg)
+}
+
+func KeyByRoute(r *http.Request) string {
+	return defaultProxy.KeyByRoute(r)
+}
+
+func Set403(func403 func(w http.ResponseWriter, r *http.Request)) {
+	defaultProxy.Set403(func403)
 }
 
 func Set404(func404 func(w http.ResponseWriter, r *http.Request)) {
@@ -206,14 +325,38 @@ func Set405(func405 func(w http.ResponseWriter, r *http.Request)) {
 	defaultProxy.Set405(func405)
 }
 
+func Set429(func429 func(w http.ResponseWriter, r *http.Request)) {
+	defaultProxy.Set429(func429)
+}
+
 func Set500(func500 func(w http.ResponseWriter, r *http.Request)) {
 	defaultProxy.Set500(func500)
 }
 
-func Run() {
-	defaultProxy.Run()
+func Run() error {
+	return defaultProxy.Run()
+}
+
+func Serve(ln net.Listener) error {
+	return defaultProxy.Serve(ln)
 }
 
 func Stop() {
 	defaultProxy.Stop()
 }
+
+func Shutdown(ctx context.Context) error {
+	return defaultProxy.Shutdown(ctx)
+}
+
+func OnShutdown(fn func()) {
+	defaultProxy.OnShutdown(fn)
+}
+
+func Wait() error {
+	return defaultProxy.Wait()
+}
+
+func HandleSignals(sig ...os.Signal) {
+	defaultProxy.HandleSignals(sig...)
+}
@@ -0,0 +1,457 @@
+// `static.go` 实现了静态文件服务。
+// 文件路径取自路由正则中名为 `path` 的捕获分组，没有时将所有非空的分组以 `/` 连接，如 `p.Handle("/static/(.+)", p.ServeStatic("assets"))`；
+// 文件可以来自任意 `fs.FS`，如使用 `embed.FS` 将静态文件打包进程序。
+// 路径必须满足 `fs.ValidPath`，包含 `..`、空路径段、反斜杠或空字符的请求一律返回 404。
+// 默认不响应目录，可通过 `IndexFile`、`DirListing` 开启，单页应用可通过 `SPA` 设置入口文件。
+// 未找到文件时调用所属 `Proxy` 的 `func404`，GET 及 HEAD 以外的请求调用 `func405`，读取文件出错时调用 `func500`。
+//
+// 响应带有根据文件内容计算的强 `ETag`（按文件名缓存，文件修改时间或大小变化后重新计算），
+// 并可通过 `CacheControl` 为不同文件设置 `Cache-Control`。
+// 使用 `Fingerprint` 时带哈希的文件名（见 `manifest.go`）以永久缓存的方式返回。
+// 存在 `.br`、`.gz` 压缩版本（如 `app.js.br`）且客户端支持时直接返回压缩后的文件。
+package server
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"html/template"
+	"io"
+	"io/fs"
+	"mime"
+	"net/http"
+	"net/url"
+	"os"
+	"path"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+type StaticOption func(h *staticHandler)
+
+type cacheRule struct {
+	re    *regexp.Regexp
+	value string
+}
+
+type etagEntry struct {
+	modtime time.Time
+	size    int64
+	etag    string
+}
+
+type staticHandler struct {
+	proxy    *Proxy
+	fsys     fs.FS
+	rules    []cacheRule
+	manifest *Manifest
+	spa      string
+	index    string
+	listing  bool
+
+	mu    sync.RWMutex
+	etags map[string]etagEntry
+}
+
+// 预压缩文件的编码及扩展名，按优先顺序排列
+var precompressed = []struct{ encoding, ext string }{
+	{"br", ".br"},
+	{"gzip", ".gz"},
+}
+
+// `CacheControl` 为文件路径（不含开头的 `/`）匹配正则 `pattern` 的文件设置 `Cache-Control` 响应头，
+// 多条规则按添加顺序匹配，先匹配者生效。
+//
+//	p.ServeFS(assets, CacheControl(`\.(css|js)$`, "public, max-age=86400"), CacheControl(`.*`, "no-cache"))
+func CacheControl(pattern, value string) StaticOption {
+	re := regexp.MustCompile(pattern)
+	return func(h *staticHandler) { h.rules = append(h.rules, cacheRule{re, value}) }
+}
+
+// `SPA` 设置单页应用的入口文件（如 `index.html`），请求的文件不存在且路径没有扩展名时返回该文件，
+// 因此前端路由（如 `/admin/users/42`）均由入口文件处理，而缺失的 `*.js`、`*.css` 等资源仍返回 404。
+func SPA(index string) StaticOption {
+	return func(h *staticHandler) { h.spa = index }
+}
+
+// `IndexFile` 设置目录的默认文件（如 `index.html`），请求目录时返回该文件。
+func IndexFile(name string) StaticOption {
+	return func(h *staticHandler) { h.index = name }
+}
+
+// `DirListing` 开启目录列表，请求没有默认文件的目录时返回列出目录内容的 HTML 页面。
+// 目录列表会暴露目录中的所有文件（以 `.` 开头的文件除外），仅应用于内部文件共享等场景。
+func DirListing() StaticOption {
+	return func(h *staticHandler) { h.listing = true }
+}
+
+// `ServeStatic` 方法传入一个目录，返回针对该目录的静态文件处理方法。
+// 文件通过 `os.Root` 访问，指向目录以外的符号链接同样返回 404；目录在首次请求时打开，无法打开时返回 404。
+func (p *Proxy) ServeStatic(dir string, opts ...StaticOption) http.Handler {
+	return p.ServeFS(&rootFS{dir: dir}, opts...)
+}
+
+// `rootFS` 延迟打开 `os.Root`，打开失败时下次访问重试。
+type rootFS struct {
+	dir  string
+	mu   sync.Mutex
+	fsys fs.FS
+}
+
+func (r *rootFS) Open(name string) (fs.File, error) {
+	r.mu.Lock()
+	if r.fsys == nil {
+		root, err := os.OpenRoot(r.dir)
+		if err != nil {
+			r.mu.Unlock()
+			return nil, &fs.PathError{Op: "open", Path: name, Err: err}
+		}
+		r.fsys = root.FS()
+	}
+	fsys := r.fsys
+	r.mu.Unlock()
+	return fsys.Open(name)
+}
+
+// `ServeFS` 返回针对 `fsys` 的静态文件处理方法。
+func (p *Proxy) ServeFS(fsys fs.FS, opts ...StaticOption) http.Handler {
+	h := &staticHandler{proxy: p, fsys: fsys, etags: make(map[string]etagEntry)}
+	for _, opt := range opts {
+		opt(h)
+	}
+	return h
+}
+
+func (h *staticHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet && r.Method != http.MethodHead {
+		w.Header().Set("Allow", "GET, HEAD")
+		h.proxy.serve405(w, r)
+		return
+	}
+
+	name, dir, ok := staticPath(r)
+	if !ok {
+		h.proxy.serve404(w, r)
+		return
+	}
+
+	if h.manifest != nil {
+		if origin, current, ok := h.manifest.origin(name); ok && !dir {
+			if current {
+				h.serveFile(w, r, origin, immutableCacheControl)
+				return
+			}
+			// 过期的哈希不能永久缓存，重定向到当前的 URL
+			u, _ := h.manifest.URL(origin)
+			if r.URL.RawQuery != "" {
+				u += "?" + r.URL.RawQuery
+			}
+			http.Redirect(w, r, u, http.StatusFound)
+			return
+		}
+	}
+
+	fi, err := fs.Stat(h.fsys, name)
+	switch {
+	case err == nil && fi.IsDir() && (h.index != "" || h.listing):
+		if !dir {
+			// 补全目录末尾的 `/`，使页面中的相对路径正确解析
+			u := *r.URL
+			u.Path += "/"
+			http.Redirect(w, r, u.String(), http.StatusMovedPermanently)
+			return
+		}
+		if h.index != "" {
+			index := path.Join(name, h.index)
+			if _, err := fs.Stat(h.fsys, index); err == nil {
+				h.serveFile(w, r, index, "")
+				return
+			}
+		}
+		if h.listing {
+			h.serveDir(w, r, name)
+			return
+		}
+	case err == nil && !fi.IsDir() && !dir:
+		h.serveFile(w, r, name, "")
+		return
+	}
+
+	// 文件不存在时，没有扩展名的路径由单页应用的入口文件响应
+	if h.spa != "" && (name == "." || path.Ext(name) == "") {
+		h.serveFile(w, r, h.spa, "")
+		return
+	}
+	h.proxy.serve404(w, r)
+}
+
+// `serveFile` 响应文件 `name`，`cacheControl` 为空时使用 `CacheControl` 规则。
+func (h *staticHandler) serveFile(w http.ResponseWriter, r *http.Request, name, cacheControl string) {
+	f, fi, err := h.open(name)
+	if err != nil {
+		h.proxy.serve404(w, r)
+		return
+	}
+	defer f.Close()
+
+	if cacheControl == "" {
+		cacheControl = h.cacheControl(name)
+	}
+	if cacheControl != "" {
+		w.Header().Set("Cache-Control", cacheControl)
+	}
+
+	key := name
+	if vf, vfi, encoding := h.variant(w, r, name); vf != nil {
+		defer vf.Close()
+		ctype := mime.TypeByExtension(path.Ext(name))
+		if ctype == "" {
+			ctype = "application/octet-stream"
+		}
+		w.Header().Set("Content-Type", ctype)
+		w.Header().Set("Content-Encoding", encoding)
+		key, f, fi = name+";"+encoding, vf, vfi
+	}
+
+	rs, etag, err := h.etag(key, fi, f)
+	if err != nil {
+		w.Header().Del("Content-Encoding")
+		h.proxy.serve500(w, r)
+		return
+	}
+	w.Header().Set("ETag", etag)
+	http.ServeContent(w, r, name, fi.ModTime(), rs)
+}
+
+// `cacheControl` 返回首个匹配 `name` 的 `CacheControl` 规则的值。
+func (h *staticHandler) cacheControl(name string) string {
+	for _, rule := range h.rules {
+		if rule.re.MatchString(name) {
+			return rule.value
+		}
+	}
+	return ""
+}
+
+// `open` 打开普通文件，目录视为不存在。
+func (h *staticHandler) open(name string) (fs.File, fs.FileInfo, error) {
+	f, err := h.fsys.Open(name)
+	if err != nil {
+		return nil, nil, err
+	}
+	fi, err := f.Stat()
+	if err == nil && fi.IsDir() {
+		err = fs.ErrNotExist
+	}
+	if err != nil {
+		f.Close()
+		return nil, nil, err
+	}
+	return f, fi, nil
+}
+
+// `variant` 查找文件的预压缩版本，存在任一版本时添加 `Vary: Accept-Encoding`，
+// 返回客户端可接受的版本中优先级最高者，均不可用时返回 `nil`。
+func (h *staticHandler) variant(w http.ResponseWriter, r *http.Request, name string) (fs.File, fs.FileInfo, string) {
+	accept := r.Header.Get("Accept-Encoding")
+	for _, pc := range precompressed {
+		f, fi, err := h.open(name + pc.ext)
+		if err != nil {
+			continue
+		}
+		addVary(w.Header(), "Accept-Encoding")
+		if acceptsEncoding(accept, pc.encoding) {
+			return f, fi, pc.encoding
+		}
+		f.Close()
+	}
+	return nil, nil, ""
+}
+
+// `etag` 返回文件内容的强 `ETag`，`key` 区分同一文件的不同压缩版本，不支持 `Seek` 的文件先读入内存。
+func (h *staticHandler) etag(name string, fi fs.FileInfo, f fs.File) (io.ReadSeeker, string, error) {
+	rs, ok := f.(io.ReadSeeker)
+	if !ok {
+		b, err := io.ReadAll(f)
+		if err != nil {
+			return nil, "", err
+		}
+		rs = bytes.NewReader(b)
+	}
+
+	h.mu.RLock()
+	e, ok := h.etags[name]
+	h.mu.RUnlock()
+	if ok && e.modtime.Equal(fi.ModTime()) && e.size == fi.Size() {
+		return rs, e.etag, nil
+	}
+
+	sum := sha256.New()
+	if _, err := io.Copy(sum, rs); err != nil {
+		return nil, "", err
+	}
+	if _, err := rs.Seek(0, io.SeekStart); err != nil {
+		return nil, "", err
+	}
+	e = etagEntry{modtime: fi.ModTime(), size: fi.Size(), etag: `"` + hex.EncodeToString(sum.Sum(nil)[:16]) + `"`}
+
+	h.mu.Lock()
+	h.etags[name] = e
+	h.mu.Unlock()
+	return rs, e.etag, nil
+}
+
+// `staticPath` 从路由参数中取出文件路径，并检查其是否为合法的 `fs.FS` 路径。
+// 文件路径取名为 `path` 的捕获分组，没有时将所有非空的分组以 `/` 连接；清理后与原路径不一致的请求视为不合法。
+// 路径为空或以 `/` 结尾时 `dir` 为 `true`，此时返回的路径不含末尾的 `/`，根目录为 `.`。
+func staticPath(r *http.Request) (name string, dir, ok bool) {
+	pm, ok := r.Context().Value(CtxParamKey).(*Params)
+	if !ok || len(pm.s) <= 1 {
+		return "", false, false
+	}
+
+	raw, ok := pm.m["path"]
+	if !ok {
+		parts := make([]string, 0, len(pm.s)-1)
+		for _, s := range pm.s[1:] {
+			if s != "" {
+				parts = append(parts, s)
+			}
+		}
+		raw = strings.Join(parts, "/")
+	}
+	dir = raw == "" || strings.HasSuffix(r.URL.Path, "/")
+	if raw = strings.TrimSuffix(raw, "/"); raw == "" {
+		raw = "."
+	}
+	name = path.Clean(raw)
+	if name != raw || !fs.ValidPath(name) || strings.ContainsAny(name, "\\\x00") {
+		return "", false, false
+	}
+	return name, dir, true
+}
+
+// `acceptsEncoding` 判断 `Accept-Encoding` 是否接受编码 `enc`。
+func acceptsEncoding(header, enc string) bool {
+	return encodingQuality(header, enc) > 0
+}
+
+// `encodingQuality` 返回 `Accept-Encoding` 中编码 `enc` 的 q 值，`*` 匹配未列出的编码，未列出时为 0。
+func encodingQuality(header, enc string) float64 {
+	q := 0.0
+	for _, part := range strings.Split(header, ",") {
+		coding, qv := parseQuality(part)
+		switch {
+		case strings.EqualFold(coding, enc):
+			return qv
+		case coding == "*":
+			q = qv
+		}
+	}
+	return q
+}
+
+// `parseQuality` 解析 `coding;q=0.5` 形式的值，省略 `q` 时为 1，无法解析时为 0。
+func parseQuality(s string) (string, float64) {
+	value, params, _ := strings.Cut(s, ";")
+	q := 1.0
+	for _, param := range strings.Split(params, ";") {
+		k, v, ok := strings.Cut(strings.TrimSpace(param), "=")
+		if ok && strings.EqualFold(strings.TrimSpace(k), "q") {
+			f, err := strconv.ParseFloat(strings.TrimSpace(v), 64)
+			if err != nil || f < 0 || f > 1 {
+				f = 0
+			}
+			q = f
+		}
+	}
+	return strings.TrimSpace(value), q
+}
+
+// `addVary` 向 `Vary` 响应头中添加 `field`，已存在时不重复添加。
+func addVary(header http.Header, field string) {
+	for _, v := range header.Values("Vary") {
+		for _, f := range strings.Split(v, ",") {
+			if f = strings.TrimSpace(f); f == "*" || strings.EqualFold(f, field) {
+				return
+			}
+		}
+	}
+	header.Add("Vary", field)
+}
+
+type dirEntry struct {
+	Name    string
+	URL     string
+	Size    string
+	ModTime string
+}
+
+// `serveDir` 输出目录列表，子目录在前，文件在后，均按名称排序。
+func (h *staticHandler) serveDir(w http.ResponseWriter, r *http.Request, name string) {
+	entries, err := fs.ReadDir(h.fsys, name)
+	if err != nil {
+		h.proxy.serve404(w, r)
+		return
+	}
+
+	var dirs, files []dirEntry
+	for _, entry := range entries {
+		if strings.HasPrefix(entry.Name(), ".") {
+			continue
+		}
+		fi, err := entry.Info()
+		if err != nil {
+			continue
+		}
+		de := dirEntry{
+			Name:    entry.Name(),
+			URL:     (&url.URL{Path: entry.Name()}).String(),
+			ModTime: fi.ModTime().Format("2006-01-02 15:04:05"),
+		}
+		if entry.IsDir() {
+			de.Name += "/"
+			de.URL += "/"
+			dirs = append(dirs, de)
+		} else {
+			de.Size = strconv.FormatInt(fi.Size(), 10)
+			files = append(files, de)
+		}
+	}
+
+	var buf bytes.Buffer
+	data := map[string]interface{}{"Path": r.URL.Path, "Root": name == ".", "Entries": append(dirs, files...)}
+	if err := dirTemplate.Execute(&buf, data); err != nil {
+		h.proxy.serve500(w, r)
+		return
+	}
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.Header().Set("Cache-Control", "no-cache")
+	buf.WriteTo(w)
+}
+
+var dirTemplate = template.Must(template.New("dir").Parse(`<!DOCTYPE html>
+<html>
+<head>
+<meta charset="utf-8">
+<title>Index of {{.Path}}</title>
+<style>
+body { font: 14px/1.5 sans-serif; margin: 16px 24px; }
+table { border-collapse: collapse; }
+td, th { text-align: left; padding: 2px 16px 2px 0; font-family: monospace; }
+td.size { text-align: right; }
+</style>
+</head>
+<body>
+<h1>Index of {{.Path}}</h1>
+<table>
+<tr><th>Name</th><th>Size</th><th>Modified</th></tr>
+{{if not .Root}}<tr><td><a href="../">../</a></td><td></td><td></td></tr>
+{{end}}{{range .Entries}}<tr><td><a href="{{.URL}}">{{.Name}}</a></td><td class="size">{{.Size}}</td><td>{{.ModTime}}</td></tr>
+{{end}}</table>
+</body>
+</html>
+`))
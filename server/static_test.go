@@ -0,0 +1,291 @@
+package server
+
+import (
+	"context"
+	"errors"
+	"io/fs"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"testing/fstest"
+)
+
+func TestServeFS(t *testing.T) {
+	fsys := fstest.MapFS{
+		"app.js":       {Data: []byte("console.log(1)")},
+		"css/site.css": {Data: []byte("body{}")},
+	}
+
+	p := NewProxy(context.Background(), ":0", nil)
+	p.Set404(func(w http.ResponseWriter, r *http.Request) { http.Error(w, "custom 404", 404) })
+	p.Set405(func(w http.ResponseWriter, r *http.Request) { http.Error(w, "custom 405", 405) })
+	p.Handle(`/static/(.+)`, p.ServeFS(fsys))
+
+	if w := serve(p, "GET", "/static/css/site.css"); w.Code != 200 || w.Body.String() != "body{}" {
+		t.Errorf("unexpected response %d %q", w.Code, w.Body.String())
+	}
+	if w := serve(p, "HEAD", "/static/app.js"); w.Code != 200 || w.Body.Len() != 0 {
+		t.Errorf("unexpected HEAD response %d %q", w.Code, w.Body.String())
+	}
+	if w := serve(p, "POST", "/static/app.js"); w.Body.String() != "custom 405\n" || w.Header().Get("Allow") != "GET, HEAD" {
+		t.Errorf("expect custom 405, got %q", w.Body.String())
+	}
+	for _, target := range []string{
+		"/static/missing.js",
+		"/static/css",
+		"/static/css/",
+		"/static/../url.go",
+		"/static/css/..%2fapp.js",
+		"/static/css//site.css",
+		"/static/.%2fapp.js",
+		`/static/css%5csite.css`,
+		"/static/app.js%00",
+	} {
+		if w := serve(p, "GET", target); w.Body.String() != "custom 404\n" {
+			t.Errorf("%s: expect custom 404, got %d %q", target, w.Code, w.Body.String())
+		}
+	}
+}
+
+func TestServeStatic(t *testing.T) {
+	dir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(dir, "a.txt"), []byte("hello"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	secret := filepath.Join(filepath.Dir(dir), "secret.txt")
+	if err := os.WriteFile(secret, []byte("secret"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	defer os.Remove(secret)
+
+	p := NewProxy(context.Background(), ":0", nil)
+	p.Handle(`/files/(.+)`, p.ServeStatic(dir))
+
+	if w := serve(p, "GET", "/files/a.txt"); w.Body.String() != "hello" {
+		t.Errorf("unexpected body %q", w.Body.String())
+	}
+	if w := serve(p, "GET", "/files/..%2fsecret.txt"); w.Code != http.StatusNotFound {
+		t.Errorf("expect 404 for traversal, got %d %q", w.Code, w.Body.String())
+	}
+
+	// 指向目录以外的符号链接
+	if err := os.Symlink(secret, filepath.Join(dir, "link.txt")); err != nil {
+		t.Skip(err)
+	}
+	if w := serve(p, "GET", "/files/link.txt"); w.Code != http.StatusNotFound {
+		t.Errorf("expect 404 for escaping symlink, got %d %q", w.Code, w.Body.String())
+	}
+}
+
+func TestStaticPathCapture(t *testing.T) {
+	fsys := fstest.MapFS{"css/site.css": {Data: []byte("body{}")}}
+	p := NewProxy(context.Background(), ":0", nil)
+	p.Handle(`/static/(css|js)/(.+)`, p.ServeFS(fsys))
+	p.Handle(`/v(\d+)/(?P<path>.+)`, p.ServeFS(fsys))
+	p.Handle(`/named/(?P<path>.+)/(v\d+)`, p.ServeFS(fsys))
+
+	// 没有 `path` 分组时连接所有分组，否则仅使用 `path` 分组
+	for _, target := range []string{"/static/css/site.css", "/v1/css/site.css", "/named/css/site.css/v2"} {
+		if w := serve(p, "GET", target); w.Body.String() != "body{}" {
+			t.Errorf("%s: unexpected response %d %q", target, w.Code, w.Body.String())
+		}
+	}
+}
+
+func TestServeStaticMissingDir(t *testing.T) {
+	dir := filepath.Join(t.TempDir(), "later")
+	p := NewProxy(context.Background(), ":0", nil)
+	p.Set404(func(w http.ResponseWriter, r *http.Request) { http.Error(w, "custom 404", 404) })
+	p.Handle(`/files/(.+)`, p.ServeStatic(dir))
+
+	// 目录不存在时返回 404，创建后即可访问
+	if w := serve(p, "GET", "/files/a.txt"); w.Body.String() != "custom 404\n" {
+		t.Errorf("expect custom 404, got %d %q", w.Code, w.Body.String())
+	}
+	if err := os.Mkdir(dir, 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(dir, "a.txt"), []byte("hello"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if w := serve(p, "GET", "/files/a.txt"); w.Body.String() != "hello" {
+		t.Errorf("unexpected response %d %q", w.Code, w.Body.String())
+	}
+}
+
+func TestStaticCaching(t *testing.T) {
+	fsys := fstest.MapFS{
+		"app.js":    {Data: []byte("console.log(1)")},
+		"app.js.br": {Data: []byte("br-data")},
+		"app.js.gz": {Data: []byte("gz-data")},
+		"logo.png":  {Data: []byte("png")},
+	}
+
+	p := NewProxy(context.Background(), ":0", nil)
+	p.Handle(`/static/(.+)`, p.ServeFS(fsys,
+		CacheControl(`\.js$`, "public, max-age=86400"),
+		CacheControl(`.*`, "no-cache"),
+	))
+
+	get := func(target, accept string, header ...string) *httptest.ResponseRecorder {
+		r := httptest.NewRequest("GET", target, nil)
+		if accept != "" {
+			r.Header.Set("Accept-Encoding", accept)
+		}
+		for i := 0; i < len(header); i += 2 {
+			r.Header.Set(header[i], header[i+1])
+		}
+		w := httptest.NewRecorder()
+		p.ServeHTTP(w, r)
+		return w
+	}
+
+	w := get("/static/app.js", "")
+	if w.Body.String() != "console.log(1)" || w.Header().Get("Content-Encoding") != "" {
+		t.Errorf("unexpected identity response %q", w.Body.String())
+	}
+	if cc := w.Header().Get("Cache-Control"); cc != "public, max-age=86400" {
+		t.Errorf("unexpected Cache-Control %q", cc)
+	}
+	if v := w.Header().Get("Vary"); v != "Accept-Encoding" {
+		t.Errorf("unexpected Vary %q", v)
+	}
+	identity := w.Header().Get("ETag")
+	if len(identity) != 34 || identity[0] != '"' {
+		t.Errorf("expect strong ETag, got %q", identity)
+	}
+
+	if w := get("/static/app.js", "", "If-None-Match", identity); w.Code != http.StatusNotModified {
+		t.Errorf("expect 304, got %d", w.Code)
+	}
+
+	for _, c := range []struct{ accept, encoding, body string }{
+		{"gzip, deflate, br", "br", "br-data"},
+		{"gzip", "gzip", "gz-data"},
+		{"br;q=0, gzip;q=0.5", "gzip", "gz-data"},
+		{"*", "br", "br-data"},
+		{"*;q=0, identity", "", "console.log(1)"},
+	} {
+		w := get("/static/app.js", c.accept)
+		if w.Body.String() != c.body || w.Header().Get("Content-Encoding") != c.encoding {
+			t.Errorf("%q: unexpected response %q encoding %q", c.accept, w.Body.String(), w.Header().Get("Content-Encoding"))
+		}
+		if ct := w.Header().Get("Content-Type"); !strings.HasPrefix(ct, "text/javascript") {
+			t.Errorf("%q: unexpected Content-Type %q", c.accept, ct)
+		}
+		if etag := w.Header().Get("ETag"); (etag == identity) != (c.encoding == "") {
+			t.Errorf("%q: unexpected ETag %q", c.accept, etag)
+		}
+	}
+
+	w = get("/static/logo.png", "br")
+	if w.Header().Get("Cache-Control") != "no-cache" || w.Header().Get("Vary") != "" {
+		t.Errorf("unexpected headers %v", w.Header())
+	}
+}
+
+func TestStaticSPA(t *testing.T) {
+	fsys := fstest.MapFS{
+		"index.html":    {Data: []byte("<app>")},
+		"assets/app.js": {Data: []byte("js")},
+	}
+	p := NewProxy(context.Background(), ":0", nil)
+	p.Handle(`/admin/(.*)`, p.ServeFS(fsys, SPA("index.html"), CacheControl(`\.html$`, "no-cache")))
+
+	for _, target := range []string{"/admin/", "/admin/users/42", "/admin/users/", "/admin/assets"} {
+		w := serve(p, "GET", target)
+		if w.Code != http.StatusOK || w.Body.String() != "<app>" {
+			t.Errorf("%s: expect index.html, got %d %q", target, w.Code, w.Body.String())
+		}
+		if ct, cc := w.Header().Get("Content-Type"), w.Header().Get("Cache-Control"); !strings.HasPrefix(ct, "text/html") || cc != "no-cache" {
+			t.Errorf("%s: unexpected headers %q %q", target, ct, cc)
+		}
+	}
+	if w := serve(p, "GET", "/admin/assets/app.js"); w.Body.String() != "js" {
+		t.Errorf("unexpected asset %q", w.Body.String())
+	}
+	for _, target := range []string{"/admin/assets/missing.js", "/admin/missing.css", "/admin/assets/app.js/"} {
+		if w := serve(p, "GET", target); w.Code != http.StatusNotFound {
+			t.Errorf("%s: expect 404, got %d", target, w.Code)
+		}
+	}
+}
+
+func TestStaticDirectories(t *testing.T) {
+	fsys := fstest.MapFS{
+		"docs/index.html":     {Data: []byte("docs")},
+		"share/a <b>.txt":     {Data: []byte("a")},
+		"share/sub/c.txt":     {Data: []byte("c")},
+		"share/.hidden":       {Data: []byte("h")},
+		"share/x:y.txt":       {Data: []byte("x")},
+		"share/sub/d/e.txt":   {Data: []byte("e")},
+		"share/sub/d/f.tar.z": {Data: []byte("f")},
+	}
+
+	p := NewProxy(context.Background(), ":0", nil)
+	p.Handle(`/plain/(.*)`, p.ServeFS(fsys))
+	p.Handle(`/files/(.*)`, p.ServeFS(fsys, IndexFile("index.html"), DirListing()))
+
+	if w := serve(p, "GET", "/plain/docs/"); w.Code != http.StatusNotFound {
+		t.Errorf("directories should be 404 by default, got %d", w.Code)
+	}
+	if w := serve(p, "GET", "/files/docs/"); w.Body.String() != "docs" {
+		t.Errorf("expect index.html, got %q", w.Body.String())
+	}
+	if w := serve(p, "GET", "/files/docs?x=1"); w.Code != http.StatusMovedPermanently || w.Header().Get("Location") != "/files/docs/?x=1" {
+		t.Errorf("expect redirect, got %d %q", w.Code, w.Header().Get("Location"))
+	}
+
+	w := serve(p, "GET", "/files/share/")
+	body := w.Body.String()
+	if w.Code != http.StatusOK || !strings.HasPrefix(w.Header().Get("Content-Type"), "text/html") {
+		t.Fatalf("expect listing, got %d %q", w.Code, body)
+	}
+	for _, s := range []string{
+		`<a href="../">../</a>`,
+		`<a href="sub/">sub/</a>`,
+		`<a href="a%20%3Cb%3E.txt">a &lt;b&gt;.txt</a>`,
+		`<a href="./x:y.txt">x:y.txt</a>`,
+	} {
+		if !strings.Contains(body, s) {
+			t.Errorf("missing %q in listing\n%s", s, body)
+		}
+	}
+	if strings.Contains(body, ".hidden") {
+		t.Error("listing should skip hidden files")
+	}
+	if strings.Index(body, "sub/") > strings.Index(body, "a &lt;b&gt;.txt") {
+		t.Error("directories should be listed before files")
+	}
+	if w := serve(p, "GET", "/files/"); strings.Contains(w.Body.String(), `href="../"`) {
+		t.Error("root listing should not link to parent")
+	}
+}
+
+// `brokenFS` 中的文件无法读取
+type brokenFS struct{ fstest.MapFS }
+
+type brokenFile struct{ fs.File }
+
+func (f brokenFile) Read([]byte) (int, error) { return 0, errors.New("broken") }
+
+func (b brokenFS) Open(name string) (fs.File, error) {
+	f, err := b.MapFS.Open(name)
+	if err != nil {
+		return nil, err
+	}
+	return brokenFile{f}, nil
+}
+
+func TestStaticReadError(t *testing.T) {
+	p := NewProxy(context.Background(), ":0", nil)
+	p.Set500(func(w http.ResponseWriter, r *http.Request) { http.Error(w, "custom 500", 500) })
+	p.Handle(`/static/(.+)`, p.ServeFS(brokenFS{fstest.MapFS{"app.js": {Data: []byte("x")}}}))
+
+	if w := serve(p, "GET", "/static/app.js"); w.Body.String() != "custom 500\n" {
+		t.Errorf("expect custom 500, got %d %q", w.Code, w.Body.String())
+	}
+}
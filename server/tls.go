@@ -0,0 +1,218 @@
+// `tls.go` 实现了 HTTPS 服务。
+// 证书由 `CertReloader` 加载，证书文件更新后无需重启即可生效；
+// 配置多组证书时按 SNI 选择与客户端请求的域名相符的证书。
+package server
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"net"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+type CertPair struct {
+	CertFile string
+	KeyFile  string
+}
+
+// `CertReloader` 在握手时检查证书文件的修改时间，文件变化后重新加载证书，
+// 重新加载失败时继续使用原有的证书。
+type CertReloader struct {
+	rw       *sync.RWMutex
+	pairs    []CertPair
+	certs    []*tls.Certificate
+	stamps   []string
+	interval time.Duration
+	checked  time.Time
+}
+
+func NewCertReloader(pairs ...CertPair) (*CertReloader, error) {
+	if len(pairs) == 0 {
+		return nil, errors.New("server: no certificate pair")
+	}
+	cr := &CertReloader{
+		rw:       new(sync.RWMutex),
+		pairs:    pairs,
+		certs:    make([]*tls.Certificate, len(pairs)),
+		stamps:   make([]string, len(pairs)),
+		interval: time.Second,
+	}
+	for i := range pairs {
+		if err := cr.load(i); err != nil {
+			return nil, err
+		}
+	}
+	cr.checked = time.Now()
+	return cr, nil
+}
+
+// `stamp` 以证书及私钥文件的修改时间和大小标识文件版本。
+func (cr *CertReloader) stamp(i int) (string, error) {
+	var s string
+	for _, name := range []string{cr.pairs[i].CertFile, cr.pairs[i].KeyFile} {
+		fi, err := os.Stat(name)
+		if err != nil {
+			return "", err
+		}
+		s += fi.ModTime().String() + "/" + strconv.FormatInt(fi.Size(), 10) + ";"
+	}
+	return s, nil
+}
+
+func (cr *CertReloader) load(i int) error {
+	stamp, err := cr.stamp(i)
+	if err != nil {
+		return err
+	}
+	cert, err := tls.LoadX509KeyPair(cr.pairs[i].CertFile, cr.pairs[i].KeyFile)
+	if err != nil {
+		return err
+	}
+	if cert.Leaf == nil {
+		if cert.Leaf, err = x509.ParseCertificate(cert.Certificate[0]); err != nil {
+			return err
+		}
+	}
+	cr.certs[i], cr.stamps[i] = &cert, stamp
+	return nil
+}
+
+// `Reload` 重新加载文件已变化的证书，返回遇到的第一个错误。
+func (cr *CertReloader) Reload() error {
+	cr.rw.Lock()
+	defer cr.rw.Unlock()
+
+	var first error
+	for i := range cr.pairs {
+		stamp, err := cr.stamp(i)
+		if err == nil && stamp == cr.stamps[i] {
+			continue
+		}
+		if err == nil {
+			err = cr.load(i)
+		}
+		if err != nil && first == nil {
+			first = err
+		}
+	}
+	cr.checked = time.Now()
+	return first
+}
+
+// `GetCertificate` 用于 `tls.Config.GetCertificate`，没有与 SNI 相符的证书时返回第一组证书。
+func (cr *CertReloader) GetCertificate(hello *tls.ClientHelloInfo) (*tls.Certificate, error) {
+	cr.rw.RLock()
+	stale := time.Since(cr.checked) >= cr.interval
+	cr.rw.RUnlock()
+	if stale {
+		cr.Reload()
+	}
+
+	cr.rw.RLock()
+	defer cr.rw.RUnlock()
+	for _, cert := range cr.certs {
+		if hello.SupportsCertificate(cert) == nil {
+			return cert, nil
+		}
+	}
+	return cr.certs[0], nil
+}
+
+// `RunTLS` 使用证书及私钥文件监听 HTTPS 请求，证书文件更新后自动重新加载。
+func (p *Proxy) RunTLS(certFile, keyFile string) error {
+	cr, err := NewCertReloader(CertPair{certFile, keyFile})
+	if err != nil {
+		return err
+	}
+	return p.RunTLSConfig(&tls.Config{GetCertificate: cr.GetCertificate})
+}
+
+// `RunTLSConfig` 使用指定的 `tls.Config` 监听 HTTPS 请求，服务器已关闭时返回 `http.ErrServerClosed`，
+// 多组证书可通过 `NewCertReloader` 生成的 `GetCertificate` 提供。
+func (p *Proxy) RunTLSConfig(cfg *tls.Config) error {
+	p.rw.RLock()
+	addr, mode, closed := p.address, p.socketMode, p.closed
+	p.rw.RUnlock()
+	if closed {
+		return http.ErrServerClosed
+	}
+	if addr == "" {
+		addr = ":https"
+	}
+
+	cfg = cfg.Clone()
+	if len(cfg.NextProtos) == 0 {
+		cfg.NextProtos = []string{"h2", "http/1.1"}
+	}
+
+	ln, err := bind(addr, mode)
+	if err != nil {
+		return err
+	}
+
+	p.rw.Lock()
+	_, p.tlsPort, _ = net.SplitHostPort(ln.Addr().String())
+	p.rw.Unlock()
+
+	if err := p.serve(tls.NewListener(ln, cfg), ln); err != nil {
+		ln.Close()
+		return err
+	}
+	return nil
+}
+
+// `RedirectHTTPS` 在 `addr` 上监听 HTTP 请求并重定向到 HTTPS，需在 `RunTLS` 之后调用，
+// 服务器已关闭时返回 `http.ErrServerClosed`。
+func (p *Proxy) RedirectHTTPS(addr string) error {
+	p.rw.RLock()
+	closed := p.closed
+	p.rw.RUnlock()
+	if closed {
+		return http.ErrServerClosed
+	}
+
+	ln, err := bind(addr, 0)
+	if err != nil {
+		return err
+	}
+
+	p.rw.Lock()
+	defer p.rw.Unlock()
+	if p.closed {
+		ln.Close()
+		return http.ErrServerClosed
+	}
+	defer notifyReady()
+	port := p.tlsPort
+	srv := &http.Server{
+		Handler: http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			host := r.Host
+			if h, _, err := net.SplitHostPort(host); err == nil {
+				host = h
+			}
+			if strings.Contains(host, ":") {
+				host = "[" + host + "]"
+			}
+			if port != "" && port != "443" {
+				host += ":" + port
+			}
+
+			code := http.StatusMovedPermanently
+			if r.Method != http.MethodGet && r.Method != http.MethodHead {
+				code = http.StatusPermanentRedirect
+			}
+			http.Redirect(w, r, "https://"+host+r.URL.RequestURI(), code)
+		}),
+		ReadHeaderTimeout: 10 * time.Second,
+	}
+	p.servers = append(p.servers, srv)
+	p.handoff = append(p.handoff, ln)
+	go srv.Serve(ln)
+	return nil
+}
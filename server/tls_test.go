@@ -0,0 +1,155 @@
+package server
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// `writeCert` 生成自签名证书并写入 `dir`，返回证书及私钥文件路径。
+func writeCert(t *testing.T, dir, name string, serial int64) (string, string) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tmpl := &x509.Certificate{
+		SerialNumber: big.NewInt(serial),
+		Subject:      pkix.Name{CommonName: name},
+		DNSNames:     []string{name},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, tmpl, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	keyDer, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	certFile, keyFile := filepath.Join(dir, name+".crt"), filepath.Join(dir, name+".key")
+	certPEM := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der})
+	keyPEM := pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDer})
+	if err := os.WriteFile(certFile, certPEM, 0600); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(keyFile, keyPEM, 0600); err != nil {
+		t.Fatal(err)
+	}
+	// 确保修改时间发生变化
+	mtime := time.Now().Add(time.Duration(serial) * time.Second)
+	os.Chtimes(certFile, mtime, mtime)
+	os.Chtimes(keyFile, mtime, mtime)
+	return certFile, keyFile
+}
+
+func peerSerial(t *testing.T, addr, name string) int64 {
+	conn, err := tls.Dial("tcp", addr, &tls.Config{ServerName: name, InsecureSkipVerify: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	return conn.ConnectionState().PeerCertificates[0].SerialNumber.Int64()
+}
+
+func TestRunTLSReload(t *testing.T) {
+	dir := t.TempDir()
+	certFile, keyFile := writeCert(t, dir, "localhost", 1)
+
+	p := NewProxy(context.Background(), "127.0.0.1:0", nil)
+	p.Handle(`/`, nameHandler("tls"))
+	cr, err := NewCertReloader(CertPair{certFile, keyFile})
+	if err != nil {
+		t.Fatal(err)
+	}
+	cr.interval = 0
+	if err := p.RunTLSConfig(&tls.Config{GetCertificate: cr.GetCertificate}); err != nil {
+		t.Fatal(err)
+	}
+	defer p.Stop()
+	addr := p.Addrs()[0].String()
+
+	if serial := peerSerial(t, addr, "localhost"); serial != 1 {
+		t.Errorf("expect serial 1, got %d", serial)
+	}
+
+	writeCert(t, dir, "localhost", 2)
+	if serial := peerSerial(t, addr, "localhost"); serial != 2 {
+		t.Errorf("expect reloaded serial 2, got %d", serial)
+	}
+
+	// 证书文件损坏时继续使用原有证书
+	os.WriteFile(certFile, []byte("broken"), 0600)
+	if serial := peerSerial(t, addr, "localhost"); serial != 2 {
+		t.Errorf("expect serial 2 after broken reload, got %d", serial)
+	}
+}
+
+func TestRunTLSSNI(t *testing.T) {
+	dir := t.TempDir()
+	aCert, aKey := writeCert(t, dir, "a.test", 10)
+	bCert, bKey := writeCert(t, dir, "b.test", 20)
+
+	cr, err := NewCertReloader(CertPair{aCert, aKey}, CertPair{bCert, bKey})
+	if err != nil {
+		t.Fatal(err)
+	}
+	p := NewProxy(context.Background(), "127.0.0.1:0", nil)
+	if err := p.RunTLSConfig(&tls.Config{GetCertificate: cr.GetCertificate}); err != nil {
+		t.Fatal(err)
+	}
+	defer p.Stop()
+	addr := p.Addrs()[0].String()
+
+	if serial := peerSerial(t, addr, "a.test"); serial != 10 {
+		t.Errorf("expect serial 10, got %d", serial)
+	}
+	if serial := peerSerial(t, addr, "b.test"); serial != 20 {
+		t.Errorf("expect serial 20, got %d", serial)
+	}
+}
+
+func TestRedirectHTTPS(t *testing.T) {
+	dir := t.TempDir()
+	certFile, keyFile := writeCert(t, dir, "localhost", 1)
+
+	p := NewProxy(context.Background(), "127.0.0.1:0", nil)
+	if err := p.RunTLS(certFile, keyFile); err != nil {
+		t.Fatal(err)
+	}
+	if err := p.RedirectHTTPS("127.0.0.1:0"); err != nil {
+		t.Fatal(err)
+	}
+	defer p.Stop()
+
+	p.rw.RLock()
+	port, srv := p.tlsPort, p.servers[0]
+	p.rw.RUnlock()
+
+	w := httptest.NewRecorder()
+	srv.Handler.ServeHTTP(w, httptest.NewRequest("GET", "http://example.com/a/?b=1", nil))
+	if loc := w.Header().Get("Location"); w.Code != 301 || loc != "https://example.com:"+port+"/a/?b=1" {
+		t.Errorf("unexpected redirect %d %s", w.Code, loc)
+	}
+
+	w = httptest.NewRecorder()
+	srv.Handler.ServeHTTP(w, httptest.NewRequest("POST", "http://example.com/a/", nil))
+	if w.Code != http.StatusPermanentRedirect {
+		t.Errorf("expect 308, got %d", w.Code)
+	}
+}
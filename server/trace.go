@@ -0,0 +1,301 @@
+// `trace.go` 实现了请求追踪。
+// 开启追踪后每个请求结束时都会生成一条 `Trace` 记录，经过有界队列由单独的 goroutine 交给 `TraceSink` 处理；
+// 可通过采样方法减少普通请求的记录数量，发生 panic 的请求始终会被记录。
+// 队列已满时按溢出策略丢弃或阻塞，丢弃的数量可通过 `DroppedTraces` 获取。
+package server
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"math/rand"
+	"sync"
+	"time"
+)
+
+type Trace struct {
+	Time       time.Time
+	Method     string
+	Path       string
+	Pattern    string
+	Name       string
+	Status     int
+	Bytes      int64
+	Latency    time.Duration
+	RemoteAddr string
+	RequestID  string
+
+	// panic 信息
+	Err   interface{}
+	Stack []byte
+}
+
+func (t *Trace) PrintStack(w io.Writer) (n int64, err error) {
+	if t.Stack == nil {
+		return
+	}
+	var buf bytes.Buffer
+	buf.WriteString("=== DEBUG - PRINT STACK - [" + time.Now().Format("2006-01-02 15:04:05") + "] ===\n")
+	buf.Write(t.Stack)
+	buf.WriteString("\n")
+	return buf.WriteTo(w)
+}
+
+// `TraceSink` 接收请求追踪记录，`Send` 在队列的 goroutine 中依次调用，阻塞时队列中的记录会积压。
+// 若同时实现了 `io.Closer`，关闭服务器时会在队列中的记录处理完毕后调用其 `Close` 方法。
+type TraceSink interface {
+	Send(t *Trace)
+}
+
+// `ChanSink` 将追踪记录发送到 channel 中，`ctx` 结束后不再发送，关闭服务器时关闭该 channel。
+type ChanSink struct {
+	ctx context.Context
+	C   chan *Trace
+}
+
+func NewChanSink(ctx context.Context, C chan *Trace) *ChanSink {
+	return &ChanSink{ctx: ctx, C: C}
+}
+
+func (cs *ChanSink) Send(t *Trace) {
+	select {
+	case <-cs.ctx.Done():
+	case cs.C <- t:
+	}
+}
+
+func (cs *ChanSink) Close() error {
+	close(cs.C)
+	return nil
+}
+
+// `SampleRate` 返回按比例随机采样的采样方法，`rate` 取值范围为 0 ~ 1。
+func SampleRate(rate float64) func(t *Trace) bool {
+	return func(t *Trace) bool { return rand.Float64() < rate }
+}
+
+// `SetTraceSink` 设置追踪记录的接收者，`nil` 表示关闭追踪。
+func (p *Proxy) SetTraceSink(sink TraceSink) {
+	p.rw.Lock()
+	defer p.rw.Unlock()
+	p.sink = sink
+	p.tracing = sink != nil
+}
+
+// `SetTraceSampler` 设置采样方法，返回 `false` 的记录将被丢弃，`nil` 表示记录所有请求。
+func (p *Proxy) SetTraceSampler(fn func(t *Trace) bool) {
+	p.rw.Lock()
+	defer p.rw.Unlock()
+	p.sampler = fn
+}
+
+func WithTraceSink(sink TraceSink) Option {
+	return func(p *Proxy) {
+		p.sink = sink
+		p.tracing = sink != nil
+	}
+}
+
+func WithTraceSampler(fn func(t *Trace) bool) Option {
+	return func(p *Proxy) { p.sampler = fn }
+}
+
+type traceKey struct{}
+
+// `TraceFromContext` 返回当前请求的追踪记录，未开启追踪时返回 `nil`。
+// 记录在请求结束后才会发送，中间件可以在此之前补充信息。
+func TraceFromContext(ctx context.Context) *Trace {
+	t, _ := ctx.Value(traceKey{}).(*Trace)
+	return t
+}
+
+// `finishTrace` 补全追踪记录，经过采样后发送给 `TraceSink`。
+func (p *Proxy) finishTrace(t *Trace, w ResponseWriter) {
+	t.Status, t.Bytes, t.Latency = w.Status(), w.Size(), time.Since(t.Time)
+	if t.Status == 0 {
+		t.Status = 200
+	}
+
+	p.rw.RLock()
+	sink, sampler, tracing, queue := p.sink, p.sampler, p.tracing, p.queue
+	p.rw.RUnlock()
+
+	if !tracing || sink == nil {
+		return
+	}
+	if t.Err == nil && sampler != nil && !sampler(t) {
+		return
+	}
+	queue.push(t)
+}
+
+// `deliver` 在队列的 goroutine 中将记录交给当前的 `TraceSink`。
+func (p *Proxy) deliver(t *Trace) {
+	p.rw.RLock()
+	sink := p.sink
+	p.rw.RUnlock()
+	if sink != nil {
+		sink.Send(t)
+	}
+}
+
+// `DroppedTraces` 返回因队列溢出或服务器关闭而丢弃的追踪记录数。
+func (p *Proxy) DroppedTraces() uint64 {
+	p.rw.RLock()
+	queue := p.queue
+	p.rw.RUnlock()
+	return queue.droppedCount()
+}
+
+type OverflowPolicy int
+
+const (
+	// 队列已满时丢弃新的记录
+	DropNewest OverflowPolicy = iota
+	// 队列已满时丢弃最早的记录
+	DropOldest
+	// 队列已满时阻塞处理请求的 goroutine，直到队列有空位
+	Block
+)
+
+const defaultTraceQueueSize = 1024
+
+// `WithTraceQueue` 设置追踪队列的长度及溢出策略，默认长度为 1024，溢出时丢弃新的记录。
+// 运行中替换队列时，原队列停止接收新的记录，其中剩余的记录在后台处理完毕。
+func WithTraceQueue(size int, policy OverflowPolicy) Option {
+	return func(p *Proxy) {
+		old := p.queue
+		p.queue = newTraceQueue(size, policy, p.deliver)
+		if old != nil {
+			p.queue.dropped = old.droppedCount()
+			// 原队列的 goroutine 处理记录时需要获取 `p.rw`，不能在此等待
+			go old.close(context.Background())
+		}
+	}
+}
+
+// `traceQueue` 为固定长度的环形队列，由单个 goroutine 按顺序处理，该 goroutine 在第一次写入时启动。
+type traceQueue struct {
+	mu       sync.Mutex
+	notEmpty *sync.Cond
+	notFull  *sync.Cond
+	buf      []*Trace
+	head, n  int
+	policy   OverflowPolicy
+	closed   bool
+	dropped  uint64
+	deliver  func(t *Trace)
+	start    sync.Once
+	done     chan struct{}
+}
+
+func newTraceQueue(size int, policy OverflowPolicy, deliver func(t *Trace)) *traceQueue {
+	if size < 1 {
+		size = 1
+	}
+	q := &traceQueue{
+		buf:     make([]*Trace, size),
+		policy:  policy,
+		deliver: deliver,
+		done:    make(chan struct{}),
+	}
+	q.notEmpty = sync.NewCond(&q.mu)
+	q.notFull = sync.NewCond(&q.mu)
+	return q
+}
+
+func (q *traceQueue) push(t *Trace) {
+	q.start.Do(func() { go q.work() })
+
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	if q.n == len(q.buf) && !q.closed {
+		switch q.policy {
+		case DropOldest:
+			q.buf[q.head] = nil
+			q.head = (q.head + 1) % len(q.buf)
+			q.n--
+			q.dropped++
+		case Block:
+			for q.n == len(q.buf) && !q.closed {
+				q.notFull.Wait()
+			}
+		default:
+			q.dropped++
+			return
+		}
+	}
+	if q.closed {
+		q.dropped++
+		return
+	}
+
+	q.buf[(q.head+q.n)%len(q.buf)] = t
+	q.n++
+	q.notEmpty.Signal()
+}
+
+func (q *traceQueue) work() {
+	defer close(q.done)
+	for {
+		q.mu.Lock()
+		for q.n == 0 && !q.closed {
+			q.notEmpty.Wait()
+		}
+		if q.n == 0 {
+			q.mu.Unlock()
+			return
+		}
+		t := q.buf[q.head]
+		q.buf[q.head] = nil
+		q.head = (q.head + 1) % len(q.buf)
+		q.n--
+		q.notFull.Signal()
+		q.mu.Unlock()
+
+		q.deliver(t)
+	}
+}
+
+// `close` 停止接收新的记录，并等待队列中剩余的记录处理完毕或 `ctx` 结束。
+// 返回时若仍有记录未处理完毕，队列的 goroutine 会在当前记录处理完后丢弃剩余记录并退出。
+func (q *traceQueue) close(ctx context.Context) error {
+	q.mu.Lock()
+	q.closed = true
+	q.notEmpty.Broadcast()
+	q.notFull.Broadcast()
+	q.mu.Unlock()
+
+	q.start.Do(func() { close(q.done) })
+
+	select {
+	case <-q.done:
+		return nil
+	case <-ctx.Done():
+		q.mu.Lock()
+		q.dropped += uint64(q.n)
+		for ; q.n > 0; q.n-- {
+			q.buf[q.head] = nil
+			q.head = (q.head + 1) % len(q.buf)
+		}
+		q.mu.Unlock()
+		return ctx.Err()
+	}
+}
+
+// `wait` 等待队列的 goroutine 退出，`ctx` 先结束时返回 `ctx.Err()`。
+func (q *traceQueue) wait(ctx context.Context) error {
+	select {
+	case <-q.done:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+func (q *traceQueue) droppedCount() uint64 {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	return q.dropped
+}
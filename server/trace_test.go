@@ -0,0 +1,231 @@
+package server
+
+import (
+	"context"
+	"net/http"
+	"sync"
+	"testing"
+	"time"
+)
+
+type sliceSink struct {
+	mu     sync.Mutex
+	traces []*Trace
+}
+
+func (s *sliceSink) Send(t *Trace) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.traces = append(s.traces, t)
+}
+
+func TestTrace(t *testing.T) {
+	sink := new(sliceSink)
+	p := NewProxy(context.Background(), ":0", nil, WithTraceSink(sink))
+	p.Handle(`/user/{id:int}/`, View{Name: "user", Get: func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusCreated)
+		w.Write([]byte("hello"))
+	}})
+	p.Handle(`/panic/`, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) { panic("boom") }))
+
+	serve(p, "GET", "/user/1/")
+	serve(p, "GET", "/panic/")
+	serve(p, "GET", "/missing/")
+	p.Stop()
+
+	if len(sink.traces) != 3 {
+		t.Fatalf("expect 3 traces, got %d", len(sink.traces))
+	}
+	tr := sink.traces[0]
+	if tr.Method != "GET" || tr.Path != "/user/1/" || tr.Name != "user" || tr.Pattern != `^/user/(?P<id>[0-9]+)/?$` ||
+		tr.Status != 201 || tr.Bytes != 5 || tr.RemoteAddr == "" || tr.Err != nil {
+		t.Errorf("unexpected trace %+v", tr)
+	}
+	if tr = sink.traces[1]; tr.Status != 500 || tr.Err != "boom" || len(tr.Stack) == 0 {
+		t.Errorf("unexpected panic trace %+v", tr)
+	}
+	if tr = sink.traces[2]; tr.Status != 404 || tr.Pattern != "" {
+		t.Errorf("unexpected not found trace %+v", tr)
+	}
+}
+
+func TestTraceSampler(t *testing.T) {
+	sink := new(sliceSink)
+	p := NewProxy(context.Background(), ":0", nil, WithTraceSink(sink), WithTraceSampler(SampleRate(0)))
+	p.Handle(`/ok/`, nameHandler("ok"))
+	p.Handle(`/panic/`, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) { panic("boom") }))
+
+	serve(p, "GET", "/ok/")
+	serve(p, "GET", "/panic/")
+	p.Stop()
+
+	// panic 的请求不受采样影响
+	if len(sink.traces) != 1 || sink.traces[0].Err == nil {
+		t.Errorf("expect only panic trace, got %d", len(sink.traces))
+	}
+}
+
+func TestChanSink(t *testing.T) {
+	C := make(chan *Trace, 1)
+	p := NewProxy(context.Background(), ":0", C)
+	p.Handle(`/panic/`, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) { panic("boom") }))
+
+	serve(p, "GET", "/panic/")
+	if tr := <-C; tr.Path != "/panic/" || tr.Err != "boom" {
+		t.Errorf("unexpected trace %+v", tr)
+	}
+}
+
+// `blockSink` 在 `release` 关闭前阻塞所有记录的处理。
+type blockSink struct {
+	sliceSink
+	release chan struct{}
+}
+
+func (s *blockSink) Send(t *Trace) {
+	<-s.release
+	s.sliceSink.Send(t)
+}
+
+func TestTraceQueueOverflow(t *testing.T) {
+	for _, c := range []struct {
+		policy OverflowPolicy
+		first  string
+	}{
+		{DropNewest, "/1/"},
+		{DropOldest, "/2/"},
+	} {
+		sink := &blockSink{release: make(chan struct{})}
+		q := newTraceQueue(2, c.policy, sink.Send)
+		for _, path := range []string{"/0/", "/1/", "/2/", "/3/"} {
+			q.push(&Trace{Path: path})
+			// 等待第一条记录被 goroutine 取出，使其阻塞在 `Send` 中
+			time.Sleep(10 * time.Millisecond)
+		}
+		close(sink.release)
+		q.close(context.Background())
+
+		// 第一条记录已被取出，队列中保留两条，丢弃一条
+		if d := q.droppedCount(); d != 1 {
+			t.Errorf("policy %d: expect 1 dropped, got %d", c.policy, d)
+		}
+		if len(sink.traces) != 3 || sink.traces[1].Path != c.first {
+			t.Errorf("policy %d: unexpected traces %v", c.policy, sink.traces)
+		}
+	}
+}
+
+func TestTraceQueueBlock(t *testing.T) {
+	sink := &blockSink{release: make(chan struct{})}
+	q := newTraceQueue(1, Block, sink.Send)
+	q.push(&Trace{Path: "/0/"})
+	time.Sleep(10 * time.Millisecond)
+	q.push(&Trace{Path: "/1/"})
+
+	pushed := make(chan struct{})
+	go func() {
+		q.push(&Trace{Path: "/2/"})
+		close(pushed)
+	}()
+
+	select {
+	case <-pushed:
+		t.Fatal("push should block while queue is full")
+	case <-time.After(20 * time.Millisecond):
+	}
+	close(sink.release)
+	<-pushed
+	q.close(context.Background())
+
+	if len(sink.traces) != 3 || q.droppedCount() != 0 {
+		t.Errorf("expect 3 traces without drop, got %d (%d dropped)", len(sink.traces), q.droppedCount())
+	}
+}
+
+func TestReplaceTraceQueue(t *testing.T) {
+	sink := new(sliceSink)
+	p := NewProxy(context.Background(), ":0", nil, WithTraceSink(sink))
+	p.Handle(`/ok/`, nameHandler("ok"))
+	serve(p, "GET", "/ok/")
+	old := p.queue
+
+	// 处理请求的同时替换队列
+	var wg sync.WaitGroup
+	for i := 0; i < 4; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < 50; j++ {
+				serve(p, "GET", "/ok/")
+				p.DroppedTraces()
+			}
+		}()
+	}
+	p.Configure(WithTraceQueue(16, Block))
+	wg.Wait()
+
+	select {
+	case <-old.done:
+	case <-time.After(time.Second):
+		t.Error("replaced queue should be closed")
+	}
+	p.Stop()
+	if n := len(sink.traces) + int(p.DroppedTraces()); n == 0 || n > 201 {
+		t.Errorf("unexpected %d traces delivered or dropped", n)
+	}
+}
+
+func TestShutdownWithPendingTraces(t *testing.T) {
+	// 无人接收的 channel，关闭服务器时不应 panic 或阻塞
+	C := make(chan *Trace)
+	p := NewProxy(context.Background(), ":0", C, WithTraceQueue(4, DropNewest))
+	p.Handle(`/`, nameHandler("ok"))
+
+	var wg sync.WaitGroup
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			serve(p, "GET", "/")
+		}()
+	}
+	wg.Wait()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	p.Shutdown(ctx)
+	serve(p, "GET", "/")
+
+	for range C {
+	}
+	if p.DroppedTraces() == 0 {
+		t.Error("expect dropped traces")
+	}
+}
+
+func TestShutdownBlockedSink(t *testing.T) {
+	for name, sink := range map[string]TraceSink{
+		"never drains": &blockSink{release: make(chan struct{})},
+		"unread chan":  nil,
+	} {
+		p := NewProxy(context.Background(), ":0", make(chan *Trace))
+		if sink != nil {
+			p.SetTraceSink(sink)
+		}
+		p.Handle(`/a/`, nameHandler("a"))
+		for i := 0; i < 3; i++ {
+			serve(p, "GET", "/a/")
+		}
+
+		ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+		start := time.Now()
+		err := p.Shutdown(ctx)
+		cancel()
+		if elapsed := time.Since(start); elapsed > time.Second {
+			t.Errorf("%s: shutdown took %v", name, elapsed)
+		}
+		if sink != nil && err != context.DeadlineExceeded {
+			t.Errorf("%s: expect deadline exceeded, got %v", name, err)
+		}
+	}
+}
@@ -3,10 +3,8 @@
 package server
 
 import (
-	"net/http"
-	"os"
-	"path/filepath"
-	"regexp"
+	"errors"
+	"strconv"
 	"strings"
 )
 
@@ -31,65 +29,35 @@ func (p *Params) GetByIndex(i int) string {
 	return p.s[i]
 }
 
-// `parseReq` 匹配 `URL` 中的正则表达式，并将匹配结果根据组名存储在 `map[string]string` 中。
-func parseReq(r *http.Request, pattern string) (*Params, bool) {
-	re, err := regexp.Compile(pattern)
-	if err != nil {
-		panic(err)
-	}
-
-	var url string
-	if strings.HasPrefix(pattern, "^/") {
-		url = r.URL.Path
-	} else {
-		url = r.URL.Host + r.URL.Path
-	}
-
-	if !re.MatchString(url) {
-		return nil, false
+func (p *Params) lookup(key string) (string, error) {
+	if v, ok := p.m[key]; ok && key != "" {
+		return v, nil
 	}
+	return "", errors.New("server: param " + key + " not found")
+}
 
-	subName := re.SubexpNames()
-	subMatch := re.FindStringSubmatch(url)
-
-	p := &Params{
-		m: make(map[string]string),
-		s: make([]string, len(subName)),
+func (p *Params) Int(key string) (int, error) {
+	v, err := p.lookup(key)
+	if err != nil {
+		return 0, err
 	}
+	return strconv.Atoi(v)
+}
 
-	for i := 0; i < len(subName); i++ {
-		p.m[subName[i]] = subMatch[i]
-		p.s[i] = subMatch[i]
+func (p *Params) Int64(key string) (int64, error) {
+	v, err := p.lookup(key)
+	if err != nil {
+		return 0, err
 	}
-
-	return p, true
+	return strconv.ParseInt(v, 10, 64)
 }
 
-// `ServeStatic` 方法传入一个目录，返回针对该目录的静态文件处理方法。
-func ServeStatic(dir string) http.Handler {
-	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		switch r.Method {
-		case http.MethodGet:
-			ctx := r.Context()
-
-			p := ctx.Value(CtxParamKey).(*Params)
-
-			if len(p.s) <= 1 || strings.HasSuffix(r.URL.Path, "/") {
-				defaultProxy.func404(w, r)
-				return
-			}
-
-			path := filepath.Join(dir, filepath.Join(p.s[1:]...))
-			if _, err := os.Stat(path); os.IsNotExist(err) {
-				defaultProxy.func404(w, r)
-				return
-			}
-
-			http.ServeFile(w, r, path)
-		default:
-			defaultProxy.func405(w, r)
-		}
-	})
+func (p *Params) UUID(key string) (UUID, error) {
+	v, err := p.lookup(key)
+	if err != nil {
+		return UUID{}, err
+	}
+	return ParseUUID(v)
 }
 
 func regex(pattern string) string {
@@ -2,6 +2,7 @@ package server
 
 import (
 	"net/http"
+	"strings"
 )
 
 type View struct {
@@ -21,57 +22,83 @@ type View struct {
 	func405 func(w http.ResponseWriter, r *http.Request)
 }
 
-func (v View) ServeHTTP(w http.ResponseWriter, r *http.Request) {
-	switch r.Method {
+func (v View) method(m string) func(w http.ResponseWriter, r *http.Request) {
+	switch m {
 	case http.MethodGet:
-		if v.Get != nil {
-			v.Get(w, r)
-			return
-		}
+		return v.Get
 	case http.MethodHead:
-		if v.Head != nil {
-			v.Head(w, r)
-			return
-		}
+		return v.Head
 	case http.MethodPost:
-		if v.Post != nil {
-			v.Post(w, r)
-			return
-		}
+		return v.Post
 	case http.MethodOptions:
-		if v.Options != nil {
-			v.Options(w, r)
-			return
-		}
+		return v.Options
 	case http.MethodPut:
-		if v.Put != nil {
-			v.Put(w, r)
-			return
-		}
+		return v.Put
 	case http.MethodDelete:
-		if v.Delete != nil {
-			v.Delete(w, r)
-			return
-		}
+		return v.Delete
 	case http.MethodTrace:
-		if v.Trace != nil {
-			v.Trace(w, r)
-			return
-		}
+		return v.Trace
 	case http.MethodConnect:
-		if v.Connect != nil {
-			v.Connect(w, r)
-			return
-		}
+		return v.Connect
 	case http.MethodPatch:
-		if v.Patch != nil {
-			v.Patch(w, r)
-			return
+		return v.Patch
+	}
+	return nil
+}
+
+var viewMethods = []string{
+	http.MethodGet, http.MethodHead, http.MethodPost, http.MethodPut, http.MethodPatch,
+	http.MethodDelete, http.MethodOptions, http.MethodTrace, http.MethodConnect,
+}
+
+// `Allow` 返回 `View` 支持的请求方法，未实现 `Head` 时由 `Get` 提供，`Options` 始终可用。
+func (v View) Allow() []string {
+	var methods []string
+	for _, m := range viewMethods {
+		switch {
+		case v.method(m) != nil,
+			m == http.MethodHead && v.Get != nil,
+			m == http.MethodOptions:
+			methods = append(methods, m)
 		}
-	default:
-		if v.func405 != nil {
-			v.func405(w, r)
+	}
+	return methods
+}
+
+// `ServeHTTP` 根据请求方法调用相应的响应方法。
+// 未实现 `Head` 时使用 `Get` 响应并丢弃响应体，未实现 `Options` 时自动返回 `Allow` 头，
+// 其余未实现的方法返回 405 及 `Allow` 头。
+func (v View) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if fn := v.method(r.Method); fn != nil {
+		fn(w, r)
+		return
+	}
+
+	switch r.Method {
+	case http.MethodHead:
+		if v.Get != nil {
+			v.Get(headResponseWriter{w}, r)
 			return
 		}
+	case http.MethodOptions:
+		w.Header().Set("Allow", strings.Join(v.Allow(), ", "))
+		w.WriteHeader(http.StatusNoContent)
+		return
+	}
+
+	w.Header().Set("Allow", strings.Join(v.Allow(), ", "))
+	if v.func405 != nil {
+		v.func405(w, r)
+		return
 	}
+	http.Error(w, "405 method not allowed", http.StatusMethodNotAllowed)
+}
+
+// `headResponseWriter` 丢弃写入的响应体，用于以 `Get` 响应 HEAD 请求。
+type headResponseWriter struct {
+	http.ResponseWriter
 }
+
+func (hw headResponseWriter) Write(b []byte) (int, error) { return len(b), nil }
+
+func (hw headResponseWriter) Unwrap() http.ResponseWriter { return hw.ResponseWriter }
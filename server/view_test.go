@@ -0,0 +1,40 @@
+package server
+
+import (
+	"context"
+	"net/http"
+	"testing"
+)
+
+func TestView405(t *testing.T) {
+	p := NewProxy(context.Background(), ":0", nil)
+	p.Handle(`/a/`, View{Get: nameHandler("get").ServeHTTP, Patch: nameHandler("patch").ServeHTTP})
+	// 注册路由后设置的 405 方法同样生效
+	p.Set405(func(w http.ResponseWriter, r *http.Request) { http.Error(w, "custom 405", 405) })
+
+	w := serve(p, "POST", "/a/")
+	if w.Code != http.StatusMethodNotAllowed || w.Body.String() != "custom 405\n" {
+		t.Errorf("expect custom 405, got %d %q", w.Code, w.Body.String())
+	}
+	if allow := w.Header().Get("Allow"); allow != "GET, HEAD, PATCH, OPTIONS" {
+		t.Errorf("unexpected Allow %q", allow)
+	}
+}
+
+func TestViewHeadOptions(t *testing.T) {
+	p := NewProxy(context.Background(), ":0", nil)
+	p.Handle(`/a/`, View{Get: func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("X-Get", "1")
+		w.Write([]byte("body"))
+	}})
+
+	w := serve(p, "HEAD", "/a/")
+	if w.Code != 200 || w.Body.Len() != 0 || w.Header().Get("X-Get") != "1" {
+		t.Errorf("unexpected HEAD response %d %q", w.Code, w.Body.String())
+	}
+
+	w = serve(p, "OPTIONS", "/a/")
+	if w.Code != http.StatusNoContent || w.Header().Get("Allow") != "GET, HEAD, OPTIONS" {
+		t.Errorf("unexpected OPTIONS response %d %q", w.Code, w.Header().Get("Allow"))
+	}
+}
@@ -0,0 +1,84 @@
+// `writer.go` 提供记录响应状态码及响应体大小的 `http.ResponseWriter` 包装，
+// 供请求追踪及中间件使用。
+package server
+
+import (
+	"bufio"
+	"io"
+	"net"
+	"net/http"
+)
+
+type ResponseWriter interface {
+	http.ResponseWriter
+	http.Flusher
+	// 已写出的状态码，尚未写出时返回 0
+	Status() int
+	// 已写出的响应体字节数
+	Size() int64
+	Unwrap() http.ResponseWriter
+}
+
+// `WrapResponseWriter` 包装 `w`，若 `w` 已经是 `ResponseWriter` 则直接返回。
+func WrapResponseWriter(w http.ResponseWriter) ResponseWriter {
+	if rw, ok := w.(ResponseWriter); ok {
+		return rw
+	}
+	return &responseWriter{ResponseWriter: w}
+}
+
+type responseWriter struct {
+	http.ResponseWriter
+	status int
+	size   int64
+}
+
+func (rw *responseWriter) WriteHeader(code int) {
+	// 1xx 为信息性响应，之后仍会写出最终的状态码
+	if rw.status == 0 && (code < 100 || code >= 200) {
+		rw.status = code
+	}
+	rw.ResponseWriter.WriteHeader(code)
+}
+
+func (rw *responseWriter) Write(b []byte) (int, error) {
+	if rw.status == 0 {
+		rw.status = http.StatusOK
+	}
+	n, err := rw.ResponseWriter.Write(b)
+	rw.size += int64(n)
+	return n, err
+}
+
+// `ReadFrom` 保留底层 `ResponseWriter` 的 `io.ReaderFrom` 实现（如 sendfile）。
+func (rw *responseWriter) ReadFrom(r io.Reader) (int64, error) {
+	if rw.status == 0 {
+		rw.status = http.StatusOK
+	}
+	var (
+		n   int64
+		err error
+	)
+	if rf, ok := rw.ResponseWriter.(io.ReaderFrom); ok {
+		n, err = rf.ReadFrom(r)
+	} else {
+		n, err = io.Copy(rw.ResponseWriter, r)
+	}
+	rw.size += n
+	return n, err
+}
+
+func (rw *responseWriter) Flush() {
+	if rw.status == 0 {
+		rw.status = http.StatusOK
+	}
+	http.NewResponseController(rw.ResponseWriter).Flush()
+}
+
+func (rw *responseWriter) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	return http.NewResponseController(rw.ResponseWriter).Hijack()
+}
+
+func (rw *responseWriter) Status() int                 { return rw.status }
+func (rw *responseWriter) Size() int64                 { return rw.size }
+func (rw *responseWriter) Unwrap() http.ResponseWriter { return rw.ResponseWriter }
@@ -9,6 +9,7 @@ import (
 	"path/filepath"
 	"sort"
 	"sync"
+	"sync/atomic"
 )
 
 var (
@@ -24,6 +25,13 @@ func SetTmplDir(s string) {
 	dir = s
 }
 
+// `TmplDir` 返回当前的模板目录。
+func TmplDir() string {
+	rw.RLock()
+	defer rw.RUnlock()
+	return dir
+}
+
 func SetCompDir(s string) {
 	rw.Lock()
 	defer rw.Unlock()
@@ -43,8 +51,16 @@ var (
 	components  []string
 	tmplCounter = make(map[string]int64)
 	tmplCache   = make(map[string]*template.Template)
+
+	// 模板缓存命中及未命中次数
+	cacheHits, cacheMisses uint64
 )
 
+// `CacheStats` 返回模板缓存的命中及未命中次数。
+func CacheStats() (hits, misses uint64) {
+	return atomic.LoadUint64(&cacheHits), atomic.LoadUint64(&cacheMisses)
+}
+
 func RefreshCache() {
 	rw.Lock()
 	defer rw.Unlock()
@@ -111,7 +127,10 @@ func Get(name string) Template {
 		tmpl, exist = tmplCache[name]
 	})
 
-	if !exist {
+	if exist {
+		atomic.AddUint64(&cacheHits, 1)
+	} else {
+		atomic.AddUint64(&cacheMisses, 1)
 		withLock(rw.RLocker(), func() {
 			tmpl = newTemplate(name)
 			// 当每次生成新模板时，会判断当前的模板缓存的个数是否超过临界值（预设缓存数的两倍）
@@ -188,7 +188,18 @@ func (js Json) ResponseTo(ctx context.Context, w http.ResponseWriter) {
 		if err := recover(); err != nil {
 			panic(err)
 		}
+		out := js
+		if id := RequestID(ctx); id != "" && js != nil {
+			if _, ok := js["request_id"]; !ok {
+				// 不修改调用方的 `Json`，其可能被多个请求共用
+				out = make(Json, len(js)+1)
+				for k, v := range js {
+					out[k] = v
+				}
+				out["request_id"] = id
+			}
+		}
 		w.Header().Set("Content-Type", "application/json")
-		w.Write(js.Bytes())
+		w.Write(out.Bytes())
 	}
 }
@@ -0,0 +1,24 @@
+package util
+
+import (
+	"context"
+	"encoding/json"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestJsonResponseToRequestID(t *testing.T) {
+	js := Json{"code": 0}
+	for _, id := range []string{"req-1", "req-2"} {
+		w := httptest.NewRecorder()
+		js.ResponseTo(WithRequestID(context.Background(), id), w)
+
+		var body map[string]interface{}
+		if err := json.Unmarshal(w.Body.Bytes(), &body); err != nil || body["request_id"] != id {
+			t.Errorf("expect request_id %q, got %q", id, w.Body.String())
+		}
+	}
+	if _, ok := js["request_id"]; ok || len(js) != 1 {
+		t.Errorf("ResponseTo should not modify the map, got %v", js)
+	}
+}
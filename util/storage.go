@@ -9,6 +9,21 @@ type Storage interface {
 	Clear() (n int)
 }
 
+// `AtomicStorage` 为支持原子更新及遍历的 `Storage`，`NewStorage`、`NewSyncStorage` 返回的存储均实现了该接口。
+type AtomicStorage interface {
+	Storage
+	// `Update` 原子地更新 `key` 的值，`fn` 接收当前值（不存在时为 `nil`），
+	// 返回新值及是否保留，不保留时删除该 `key`。`fn` 可能被调用多次，不应有副作用
+	Update(key interface{}, fn func(old interface{}) (val interface{}, keep bool))
+	// `Range` 遍历所有的值，`fn` 返回 `false` 时停止遍历，`fn` 中可以修改存储
+	Range(fn func(key, val interface{}) bool)
+}
+
+var (
+	_ AtomicStorage = (*ShardingStorage)(nil)
+	_ AtomicStorage = (*SyncMapStorage)(nil)
+)
+
 type ShardingStorage struct {
 	Max      int
 	Fn       func(key interface{}) (i int)
@@ -79,6 +94,39 @@ func (ss *ShardingStorage) Del(key interface{}) {
 	delete(s.m, key)
 }
 
+func (ss *ShardingStorage) Update(key interface{}, fn func(old interface{}) (val interface{}, keep bool)) {
+	i := ss.Fn(key)
+	if i >= ss.Max || i < 0 {
+		i = 0
+	}
+	s := ss.Storages[i]
+	s.rw.Lock()
+	defer s.rw.Unlock()
+	if val, keep := fn(s.m[key]); keep {
+		s.m[key] = val
+	} else {
+		delete(s.m, key)
+	}
+}
+
+func (ss *ShardingStorage) Range(fn func(key, val interface{}) bool) {
+	for _, s := range ss.Storages {
+		// 复制后再遍历，使 `fn` 中可以修改存储
+		s.rw.RLock()
+		m := make(map[interface{}]interface{}, len(s.m))
+		for k, v := range s.m {
+			m[k] = v
+		}
+		s.rw.RUnlock()
+
+		for k, v := range m {
+			if !fn(k, v) {
+				return
+			}
+		}
+	}
+}
+
 func (ss *ShardingStorage) Clear() (n int) {
 	for _, s := range ss.Storages {
 		s.rw.Lock()
@@ -111,6 +159,34 @@ func (smap *SyncMapStorage) Del(key interface{}) {
 	smap.m.Delete(key)
 }
 
+// `Update` 使用比较并交换实现，存储的值需可以比较（如不含 `map`、`slice` 的结构体）。
+func (smap *SyncMapStorage) Update(key interface{}, fn func(old interface{}) (val interface{}, keep bool)) {
+	for {
+		old, loaded := smap.m.Load(key)
+		val, keep := fn(old)
+		switch {
+		case !keep && !loaded:
+			return
+		case !keep:
+			if smap.m.CompareAndDelete(key, old) {
+				return
+			}
+		case !loaded:
+			if _, loaded = smap.m.LoadOrStore(key, val); !loaded {
+				return
+			}
+		default:
+			if smap.m.CompareAndSwap(key, old, val) {
+				return
+			}
+		}
+	}
+}
+
+func (smap *SyncMapStorage) Range(fn func(key, val interface{}) bool) {
+	smap.m.Range(fn)
+}
+
 func (smap *SyncMapStorage) Clear() (n int) {
 	smap.m.Range(func(k, v interface{}) bool {
 		smap.Del(k)
@@ -0,0 +1,40 @@
+package util
+
+import (
+	"sync"
+	"testing"
+)
+
+func TestStorageUpdate(t *testing.T) {
+	for name, s := range map[string]AtomicStorage{
+		"sharding": NewStorage(4, func(key interface{}) int { return len(key.(string)) % 4 }).(AtomicStorage),
+		"sync":     NewSyncStorage().(AtomicStorage),
+	} {
+		incr := func(old interface{}) (interface{}, bool) {
+			n, _ := old.(int)
+			return n + 1, true
+		}
+
+		var wg sync.WaitGroup
+		for i := 0; i < 100; i++ {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				s.Update("a", incr)
+			}()
+		}
+		wg.Wait()
+		if n := s.Get("a"); n != 100 {
+			t.Errorf("%s: expect 100, got %v", name, n)
+		}
+
+		s.Set("bb", 1)
+		s.Range(func(key, val interface{}) bool {
+			s.Update(key, func(old interface{}) (interface{}, bool) { return old, old.(int) > 1 })
+			return true
+		})
+		if s.Get("a") != 100 || s.Get("bb") != nil {
+			t.Errorf("%s: unexpected values %v %v", name, s.Get("a"), s.Get("bb"))
+		}
+	}
+}
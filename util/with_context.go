@@ -1,9 +1,26 @@
 package util
 
-import "sync"
+import (
+	"context"
+	"sync"
+)
+
+// 请求 ID 在 context 中的键，与 `server.CtxParamKey` 相同使用字符串常量
+const CtxRequestIDKey = "ctx_request_id"
 
 func WithLocker(locker sync.Locker, fn func()) {
 	locker.Lock()
 	defer locker.Unlock()
 	fn()
 }
+
+// `WithRequestID` 返回携带请求 ID 的 context。
+func WithRequestID(ctx context.Context, id string) context.Context {
+	return context.WithValue(ctx, CtxRequestIDKey, id)
+}
+
+// `RequestID` 返回 context 中的请求 ID，不存在时返回空字符串。
+func RequestID(ctx context.Context) string {
+	id, _ := ctx.Value(CtxRequestIDKey).(string)
+	return id
+}
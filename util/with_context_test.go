@@ -1,6 +1,9 @@
 package util
 
-import "testing"
+import (
+	"context"
+	"testing"
+)
 
 var lockFlag, unlockFlag bool
 
@@ -18,3 +21,13 @@ func TestWithLocker(t *testing.T) {
 		t.Error("fail")
 	}
 }
+
+func TestRequestID(t *testing.T) {
+	ctx := context.Background()
+	if id := RequestID(ctx); id != "" {
+		t.Errorf("expect empty request id, got %q", id)
+	}
+	if id := RequestID(WithRequestID(ctx, "abc")); id != "abc" {
+		t.Errorf("expect abc, got %q", id)
+	}
+}